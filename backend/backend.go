@@ -0,0 +1,56 @@
+package backend
+
+import (
+	"time"
+)
+
+// Store is metrics backend modules write to; labels of every write are completed with device properties by the store
+type Store interface {
+	RegisterCounter(key string, name string, description string, labelNames []string) error
+	RegisterGauge(key string, name string, description string, labelNames []string) error
+	// RegisterGaugeWithUnit registers gauge with unit (e.g. "celsius") appended to its name
+	RegisterGaugeWithUnit(key string, name string, description string, unit string, labelNames []string) error
+	RegisterHistogram(key string, name string, description string, labelNames []string, buckets []float64) error
+	RegisterSummary(key string, name string, description string, labelNames []string, objectives map[float64]float64) error
+
+	CounterInc(key string, deviceName string, labels map[string]string)
+	CounterAdd(key string, deviceName string, labels map[string]string, delta float64)
+	CounterAddWithExemplar(key string, deviceName string, labels map[string]string, delta float64, exemplar map[string]string)
+	GaugeSet(key string, deviceName string, labels map[string]string, value float64)
+	GaugeAdd(key string, deviceName string, labels map[string]string, delta float64)
+	GaugeInc(key string, deviceName string, labels map[string]string)
+	GaugeSetWithTimestamp(key string, deviceName string, labels map[string]string, value float64, timestamp time.Time)
+	SensorGaugeSet(key string, deviceName string, field string, labels map[string]string, value float64, timestamp time.Time)
+	HistogramObserve(key string, deviceName string, labels map[string]string, value float64)
+	SummaryObserve(key string, deviceName string, labels map[string]string, value float64)
+
+	// RetireDevices removes series of devices, e.g. after their naming changed
+	RetireDevices(deviceNames []string)
+}
+
+type Kind string
+
+const (
+	Counter Kind = "counter"
+	Gauge   Kind = "gauge"
+)
+
+// Sample is single write of gauge or counter, as exported by the store
+type Sample struct {
+	Name   string
+	Kind   Kind
+	Device string
+	// Labels are labels of exported series, including device properties (unless they are exported in device_info only)
+	Labels map[string]string
+	// Properties are device, friendly_name, group and custom labels of device from naming configuration, even in device_info mode
+	Properties map[string]string
+	// Value is current value of series, i.e. total of counter after the write
+	Value     float64
+	Timestamp time.Time
+}
+
+// Sink receives every gauge and counter write of the store, e.g. to forward it to other time series database;
+// it is called synchronously by writing module, so it should not block
+type Sink interface {
+	Write(sample Sample)
+}
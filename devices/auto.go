@@ -0,0 +1,58 @@
+package devices
+
+import (
+	"strings"
+	"sync"
+)
+
+// AutoProperties holds names learned from metadata reported by devices themselves (e.g. Tasmota DeviceName)
+type AutoProperties struct {
+	lock       sync.RWMutex
+	properties map[string]Properties
+}
+
+func NewAutoProperties() *AutoProperties {
+	return &AutoProperties{properties: make(map[string]Properties)}
+}
+
+// Learn stores name reported by device; the first non empty of names is used.
+// Returns true when name of the device has changed.
+func (provider *AutoProperties) Learn(deviceName string, names ...string) bool {
+	var name string
+	for _, candidate := range names {
+		if candidate = strings.TrimSpace(candidate); candidate != "" {
+			name = candidate
+			break
+		}
+	}
+	if name == "" {
+		return false
+	}
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+	if previous, ok := provider.properties[deviceName]; ok && previous.Name == name {
+		return false
+	}
+	provider.properties[deviceName] = Properties{Device: deviceName, Name: name, Sensors: make(map[string]string, 0)}
+	return true
+}
+
+func (provider *AutoProperties) GetProperties(deviceName string) (*Properties, bool) {
+	provider.lock.RLock()
+	device, ok := provider.properties[deviceName]
+	provider.lock.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return &Properties{device.Device, device.Name, device.Group, device.Sensors, device.Labels, device.SensorSettings}, true
+}
+
+func (provider *AutoProperties) ListDevices() []string {
+	provider.lock.RLock()
+	defer provider.lock.RUnlock()
+	return Configuration(provider.properties).deviceNames()
+}
+
+func (provider *AutoProperties) GetDefaultLabels() map[string]string {
+	return map[string]string{}
+}
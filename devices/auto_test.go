@@ -0,0 +1,26 @@
+package devices
+
+import (
+	"testing"
+)
+
+func TestAutoProperties_Learn(t *testing.T) {
+	//given
+	provider := NewAutoProperties()
+
+	//when
+	first := provider.Learn("plug_01", "", "Kettle")
+	same := provider.Learn("plug_01", "Kettle")
+	empty := provider.Learn("plug_02", " ", "")
+
+	//then
+	if !first || same || empty {
+		t.Errorf("Learn() = %t, %t, %t, want true, false, false", first, same, empty)
+	}
+	if result, ok := provider.GetProperties("plug_01"); !ok || result.Name != "Kettle" || result.Device != "plug_01" {
+		t.Errorf("GetProperties() = %+v, %t", result, ok)
+	}
+	if _, ok := provider.GetProperties("plug_02"); ok {
+		t.Errorf("GetProperties() should not find device without reported name")
+	}
+}
@@ -0,0 +1,126 @@
+package devices
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klaper_/mqtt_data_exporter/logger"
+)
+
+const httpInventoryModuleId = "naming_http"
+
+// HTTPProperties provides devices from JSON or CSV (when served as text/csv) inventory endpoint.
+// Inventory is cached for ttl; expired inventory is still served while it is being refreshed in background,
+// and kept when refresh fails.
+type HTTPProperties struct {
+	url            string
+	ttl            time.Duration
+	declaredLabels LabelDefaults
+	client         *http.Client
+	onChange       func(changed []string)
+	now            func() time.Time
+
+	lock       sync.RWMutex
+	devices    Configuration
+	expires    time.Time
+	refreshing bool
+}
+
+// NewHTTPProperties fetches inventory from url; declaredLabels are labels declared in naming configuration
+// (the only ones CSV inventory can have columns for), onChange (if not nil) gets devices which were added,
+// removed or changed by every later refresh
+func NewHTTPProperties(url string, ttl time.Duration, timeout time.Duration, declaredLabels LabelDefaults, onChange func(changed []string)) *HTTPProperties {
+	provider := &HTTPProperties{
+		url:            url,
+		ttl:            ttl,
+		declaredLabels: declaredLabels,
+		client:         &http.Client{Timeout: timeout},
+		now:            time.Now,
+		devices:        Configuration{},
+	}
+	provider.refreshing = true
+	provider.refresh()
+	// initial inventory is not a change, series do not exist yet
+	provider.onChange = onChange
+	return provider
+}
+
+func (provider *HTTPProperties) fetch() (Configuration, error) {
+	response, err := provider.client.Get(provider.url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	format := jsonInventory
+	if strings.HasPrefix(response.Header.Get("Content-Type"), "text/csv") {
+		format = csvInventory
+	}
+	return parseInventory(provider.url, format, data, provider.declaredLabels)
+}
+
+// refresh fetches inventory; on failure previous inventory is kept until next ttl passes
+func (provider *HTTPProperties) refresh() {
+	devices, err := provider.fetch()
+
+	provider.lock.Lock()
+	provider.refreshing = false
+	provider.expires = provider.now().Add(provider.ttl)
+	if err != nil {
+		provider.lock.Unlock()
+		logger.Warn(httpInventoryModuleId, "Could not fetch inventory from %s, keeping previous one: %v", provider.url, err)
+		return
+	}
+	previous := provider.devices
+	provider.devices = devices
+	provider.lock.Unlock()
+
+	logger.Debug(httpInventoryModuleId, "Fetched %d devices from %s", len(devices), provider.url)
+	if changed := changedDevices(previous, devices); len(changed) > 0 && provider.onChange != nil {
+		provider.onChange(changed)
+	}
+}
+
+func (provider *HTTPProperties) startRefresh() {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+	if provider.refreshing {
+		return
+	}
+	provider.refreshing = true
+	go provider.refresh()
+}
+
+func (provider *HTTPProperties) GetProperties(deviceName string) (*Properties, bool) {
+	provider.lock.RLock()
+	device, ok := provider.devices[deviceName]
+	expired := !provider.refreshing && provider.now().After(provider.expires)
+	provider.lock.RUnlock()
+	if expired {
+		provider.startRefresh()
+	}
+	if !ok {
+		return nil, false
+	}
+	return &Properties{device.Device, device.Name, device.Group, device.Sensors, device.Labels, device.SensorSettings}, true
+}
+
+func (provider *HTTPProperties) ListDevices() []string {
+	provider.lock.RLock()
+	defer provider.lock.RUnlock()
+	return provider.devices.deviceNames()
+}
+
+func (provider *HTTPProperties) GetDefaultLabels() map[string]string {
+	return map[string]string{}
+}
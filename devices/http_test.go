@@ -0,0 +1,126 @@
+package devices
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type inventoryServer struct {
+	lock        sync.Mutex
+	contentType string
+	body        string
+	status      int
+	requests    int
+}
+
+func (server *inventoryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.requests++
+	w.Header().Set("Content-Type", server.contentType)
+	w.WriteHeader(server.status)
+	_, _ = w.Write([]byte(server.body))
+}
+
+func (server *inventoryServer) set(status int, body string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.status, server.body = status, body
+}
+
+func TestHTTPProperties_GetProperties(t *testing.T) {
+	//given
+	inventory := &inventoryServer{contentType: "application/json", status: http.StatusOK, body: `[{"device":"plug_01","name":"Kettle","group":"kitchen"}]`}
+	server := httptest.NewServer(inventory)
+	defer server.Close()
+
+	//when
+	provider := NewHTTPProperties(server.URL, time.Minute, time.Second, nil, nil)
+
+	//then
+	if result, ok := provider.GetProperties("plug_01"); !ok || result.Name != "Kettle" || result.Group != "kitchen" {
+		t.Errorf("GetProperties() = %+v, %t", result, ok)
+	}
+	if _, ok := provider.GetProperties("plug_02"); ok {
+		t.Errorf("GetProperties() should not find device missing in inventory")
+	}
+	if inventory.requests != 1 {
+		t.Errorf("inventory should be cached, got %d requests", inventory.requests)
+	}
+}
+
+func TestHTTPProperties_csv(t *testing.T) {
+	//given
+	inventory := &inventoryServer{contentType: "text/csv; charset=utf-8", status: http.StatusOK, body: "device,name\nplug_01,Kettle\n"}
+	server := httptest.NewServer(inventory)
+	defer server.Close()
+
+	//when
+	provider := NewHTTPProperties(server.URL, time.Minute, time.Second, nil, nil)
+
+	//then
+	if result, ok := provider.GetProperties("plug_01"); !ok || result.Name != "Kettle" {
+		t.Errorf("GetProperties() = %+v, %t", result, ok)
+	}
+}
+
+func TestHTTPProperties_refresh(t *testing.T) {
+	//given
+	inventory := &inventoryServer{contentType: "application/json", status: http.StatusOK, body: `[{"device":"plug_01","name":"Kettle"}]`}
+	server := httptest.NewServer(inventory)
+	defer server.Close()
+	changes := make(chan []string, 1)
+	provider := NewHTTPProperties(server.URL, time.Minute, time.Second, nil, func(changed []string) { changes <- changed })
+	provider.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	inventory.set(http.StatusOK, `[{"device":"plug_01","name":"Toaster"}]`)
+
+	//when
+	provider.GetProperties("plug_01")
+
+	//then
+	select {
+	case changed := <-changes:
+		if !reflect.DeepEqual(changed, []string{"plug_01"}) {
+			t.Errorf("onChange() got %+v, want [plug_01]", changed)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expired inventory was not refreshed")
+	}
+	if result, _ := provider.GetProperties("plug_01"); result.Name != "Toaster" {
+		t.Errorf("GetProperties() = %+v, want refreshed name", result)
+	}
+}
+
+func TestHTTPProperties_refreshFailureKeepsPrevious(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"server error", http.StatusInternalServerError, ""},
+		{"undeclared label", http.StatusOK, `[{"device":"plug_01","name":"Toaster","labels":{"room":"kitchen"}}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//given
+			inventory := &inventoryServer{contentType: "application/json", status: http.StatusOK, body: `[{"device":"plug_01","name":"Kettle","labels":{"owner":"alice"}}]`}
+			server := httptest.NewServer(inventory)
+			defer server.Close()
+			provider := NewHTTPProperties(server.URL, time.Minute, time.Second, LabelDefaults{"owner": ""}, nil)
+			inventory.set(tt.status, tt.body)
+
+			//when
+			provider.refreshing = true
+			provider.refresh()
+
+			//then
+			if result, ok := provider.GetProperties("plug_01"); !ok || result.Name != "Kettle" {
+				t.Errorf("GetProperties() = %+v, %t, previous inventory should be kept", result, ok)
+			}
+		})
+	}
+}
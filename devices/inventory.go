@@ -0,0 +1,212 @@
+package devices
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type inventoryFormat string
+
+const (
+	jsonInventory inventoryFormat = "json"
+	csvInventory  inventoryFormat = "csv"
+)
+
+// inventoryDevice is single entry of JSON inventory; CSV inventory has the same columns and every other column is a label.
+// Labels of both formats have to be declared in top level "labels" of naming configuration
+type inventoryDevice struct {
+	Device string            `json:"device"`
+	Name   string            `json:"name"`
+	Group  string            `json:"group"`
+	Labels map[string]string `json:"labels"`
+}
+
+var inventoryColumns = map[string]bool{"device": true, "name": true, "group": true}
+
+// parseInventory converts JSON list or CSV table of devices (e.g. exported from asset database) into Configuration
+func parseInventory(source string, format inventoryFormat, data []byte, declaredLabels LabelDefaults) (Configuration, error) {
+	var entries []inventoryDevice
+	var lines []int
+	var err error
+	switch format {
+	case csvInventory:
+		entries, lines, err = readCSVInventory(data, declaredLabels)
+	default:
+		err = json.Unmarshal(data, &entries)
+		for i := range entries {
+			lines = append(lines, i+1)
+		}
+	}
+	if err != nil {
+		return nil, ValidationErrors{{File: source, Message: err.Error()}}
+	}
+
+	var errs ValidationErrors
+	result := make(Configuration, len(entries))
+	seen := make(map[string]int, len(entries))
+	for i, entry := range entries {
+		switch {
+		case strings.TrimSpace(entry.Device) == "":
+			errs = append(errs, ValidationError{source, lines[i], "empty device"})
+		case strings.TrimSpace(entry.Name) == "":
+			errs = append(errs, ValidationError{source, lines[i], fmt.Sprintf("device %q: empty name", entry.Device)})
+		default:
+			if line, ok := seen[entry.Device]; ok {
+				errs = append(errs, ValidationError{source, lines[i], fmt.Sprintf("duplicate device %q (already defined in entry %d)", entry.Device, line)})
+				continue
+			}
+			seen[entry.Device] = lines[i]
+			if undeclared := undeclaredLabels(entry.Labels, declaredLabels); len(undeclared) > 0 {
+				errs = append(errs, ValidationError{source, lines[i], fmt.Sprintf("device %q: labels %s are not declared in top level \"labels\" of naming configuration", entry.Device, strings.Join(undeclared, ", "))})
+				continue
+			}
+			labels := entry.Labels
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			result[entry.Device] = Properties{Device: entry.Device, Name: entry.Name, Group: entry.Group, Sensors: make(map[string]string, 0), Labels: labels}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return result, nil
+}
+
+// undeclaredLabels returns sorted quoted names of labels which are not declared in naming configuration
+func undeclaredLabels(labels map[string]string, declaredLabels LabelDefaults) []string {
+	var result []string
+	for name := range labels {
+		if _, ok := declaredLabels[name]; !ok {
+			result = append(result, fmt.Sprintf("%q", name))
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// readCSVInventory reads table with header row; returns entries with their line numbers.
+// Columns which are neither device properties nor declared labels are rejected, so they are not silently dropped.
+func readCSVInventory(data []byte, declaredLabels LabelDefaults) ([]inventoryDevice, []int, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var undeclared []string
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+		if _, ok := declaredLabels[header[i]]; !ok && !inventoryColumns[header[i]] {
+			undeclared = append(undeclared, fmt.Sprintf("%q", header[i]))
+		}
+	}
+	if len(undeclared) > 0 {
+		return nil, nil, fmt.Errorf("columns %s are not declared in top level \"labels\" of naming configuration", strings.Join(undeclared, ", "))
+	}
+
+	var entries []inventoryDevice
+	var lines []int
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return entries, lines, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		entry := inventoryDevice{Labels: make(map[string]string)}
+		for i, column := range header {
+			switch column {
+			case "device":
+				entry.Device = record[i]
+			case "name":
+				entry.Name = record[i]
+			case "group":
+				entry.Group = record[i]
+			default:
+				entry.Labels[column] = record[i]
+			}
+		}
+		entries = append(entries, entry)
+		lines = append(lines, line)
+	}
+}
+
+func inventoryFormatOf(file string) inventoryFormat {
+	if strings.ToLower(filepath.Ext(file)) == ".csv" {
+		return csvInventory
+	}
+	return jsonInventory
+}
+
+// InventoryProperties provides devices listed in JSON (*.json) or CSV (*.csv) inventory file
+type InventoryProperties struct {
+	file           string
+	declaredLabels LabelDefaults
+	lock           sync.RWMutex
+	devices        Configuration
+}
+
+// NewInventoryProperties reads inventory file; declaredLabels are labels declared in naming configuration,
+// the only ones CSV inventory can have columns for
+func NewInventoryProperties(file string, declaredLabels LabelDefaults) (*InventoryProperties, error) {
+	devices, err := readInventory(file, declaredLabels)
+	if err != nil {
+		return nil, err
+	}
+	return &InventoryProperties{file: file, declaredLabels: declaredLabels, devices: devices}, nil
+}
+
+func readInventory(file string, declaredLabels LabelDefaults) (Configuration, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return parseInventory(file, inventoryFormatOf(file), data, declaredLabels)
+}
+
+// Reload reads inventory file again and swaps it only when it is valid.
+// Returns names of devices which were added, removed or changed.
+func (provider *InventoryProperties) Reload() ([]string, error) {
+	devices, err := readInventory(provider.file, provider.declaredLabels)
+	if err != nil {
+		return nil, err
+	}
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+	previous := provider.devices
+	provider.devices = devices
+	return changedDevices(previous, devices), nil
+}
+
+func (provider *InventoryProperties) GetProperties(deviceName string) (*Properties, bool) {
+	provider.lock.RLock()
+	device, ok := provider.devices[deviceName]
+	provider.lock.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return &Properties{device.Device, device.Name, device.Group, device.Sensors, device.Labels, device.SensorSettings}, true
+}
+
+func (provider *InventoryProperties) ListDevices() []string {
+	provider.lock.RLock()
+	defer provider.lock.RUnlock()
+	return provider.devices.deviceNames()
+}
+
+func (provider *InventoryProperties) GetDefaultLabels() map[string]string {
+	return map[string]string{}
+}
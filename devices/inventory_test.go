@@ -0,0 +1,105 @@
+package devices
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_parseInventory(t *testing.T) {
+	expected := Configuration{
+		"plug_01": {Device: "plug_01", Name: "Kettle", Group: "kitchen", Sensors: map[string]string{}, Labels: map[string]string{"owner": "alice"}},
+		"plug_02": {Device: "plug_02", Name: "Heater", Group: "", Sensors: map[string]string{}, Labels: map[string]string{"owner": ""}},
+	}
+	tests := []struct {
+		name   string
+		format inventoryFormat
+		input  string
+	}{
+		{"json", jsonInventory, `[{"device":"plug_01","name":"Kettle","group":"kitchen","labels":{"owner":"alice"}},{"device":"plug_02","name":"Heater","labels":{"owner":""}}]`},
+		{"csv", csvInventory, "device,name,group,owner\nplug_01,Kettle,kitchen,alice\nplug_02, Heater,,\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//when
+			result, err := parseInventory("inventory", tt.format, []byte(tt.input), LabelDefaults{"owner": ""})
+
+			//then
+			if err != nil || !reflect.DeepEqual(result, expected) {
+				t.Errorf("parseInventory() = %+v, %v, want %+v", result, err, expected)
+			}
+		})
+	}
+}
+
+func Test_parseInventory_errors(t *testing.T) {
+	//given
+	input := "device,name\nplug_01,Kettle\n,Heater\nplug_03,\nplug_01,Toaster\n"
+
+	//when
+	result, err := parseInventory("inventory.csv", csvInventory, []byte(input), LabelDefaults{})
+
+	//then
+	expected := ValidationErrors{
+		{"inventory.csv", 3, "empty device"},
+		{"inventory.csv", 4, "device \"plug_03\": empty name"},
+		{"inventory.csv", 5, "duplicate device \"plug_01\" (already defined in entry 2)"},
+	}
+	if result != nil || !reflect.DeepEqual(err, expected) {
+		t.Errorf("parseInventory() error = %#v, want %#v", err, expected)
+	}
+}
+
+func Test_parseInventory_undeclaredColumns(t *testing.T) {
+	//given
+	input := "device,name,owner,room,floor\nplug_01,Kettle,alice,kitchen,ground\n"
+
+	//when
+	result, err := parseInventory("inventory.csv", csvInventory, []byte(input), LabelDefaults{"owner": ""})
+
+	//then
+	expected := ValidationErrors{{"inventory.csv", 0, "columns \"room\", \"floor\" are not declared in top level \"labels\" of naming configuration"}}
+	if result != nil || !reflect.DeepEqual(err, expected) {
+		t.Errorf("parseInventory() error = %#v, want %#v", err, expected)
+	}
+}
+
+func Test_parseInventory_undeclaredLabels(t *testing.T) {
+	//given
+	input := `[{"device":"plug_01","name":"Kettle","labels":{"owner":"alice","room":"kitchen","floor":"ground"}},{"device":"plug_02","name":"Heater","labels":{"owner":"bob"}}]`
+
+	//when
+	result, err := parseInventory("inventory.json", jsonInventory, []byte(input), LabelDefaults{"owner": ""})
+
+	//then
+	expected := ValidationErrors{{"inventory.json", 1, "device \"plug_01\": labels \"floor\", \"room\" are not declared in top level \"labels\" of naming configuration"}}
+	if result != nil || !reflect.DeepEqual(err, expected) {
+		t.Errorf("parseInventory() error = %#v, want %#v", err, expected)
+	}
+}
+
+func TestInventoryProperties_Reload(t *testing.T) {
+	//given
+	dir, _ := ioutil.TempDir("", "inventory")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "inventory.csv")
+	writeConfiguration(t, file, "device,name\nplug_01,Kettle\nplug_02,Heater\n")
+	provider, err := NewInventoryProperties(file, LabelDefaults{})
+	if err != nil {
+		t.Fatalf("NewInventoryProperties() unexpected error: %v", err)
+	}
+	writeConfiguration(t, file, "device,name\nplug_01,Kettle\nplug_02,Fan\n")
+
+	//when
+	changed, err := provider.Reload()
+
+	//then
+	if err != nil || !reflect.DeepEqual(changed, []string{"plug_02"}) {
+		t.Errorf("Reload() => changed: %+v (expected: [plug_02]), error: %v", changed, err)
+	}
+	if result, ok := provider.GetProperties("plug_02"); !ok || result.Name != "Fan" {
+		t.Errorf("Reload() => inventory was not swapped, got: %+v", result)
+	}
+}
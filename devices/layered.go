@@ -0,0 +1,50 @@
+package devices
+
+// PropertiesSource is implemented by every naming provider (same as prom.DevicePropertiesProvider)
+type PropertiesSource interface {
+	GetProperties(deviceName string) (*Properties, bool)
+	GetDefaultLabels() map[string]string
+}
+
+// LayeredProperties asks providers in order and returns properties from the first one which knows the device,
+// so explicit configuration can be placed above names learned from devices
+type LayeredProperties struct {
+	providers []PropertiesSource
+}
+
+func NewLayeredProperties(providers ...PropertiesSource) *LayeredProperties {
+	return &LayeredProperties{providers: providers}
+}
+
+func (layered *LayeredProperties) GetProperties(deviceName string) (*Properties, bool) {
+	for _, provider := range layered.providers {
+		if properties, ok := provider.GetProperties(deviceName); ok {
+			return properties, true
+		}
+	}
+	return nil, false
+}
+
+// ListDevices merges devices of all providers which know their devices up front
+func (layered *LayeredProperties) ListDevices() []string {
+	devices := make(Configuration)
+	for _, provider := range layered.providers {
+		if lister, ok := provider.(interface{ ListDevices() []string }); ok {
+			for _, device := range lister.ListDevices() {
+				devices[device] = Properties{}
+			}
+		}
+	}
+	return devices.deviceNames()
+}
+
+// GetDefaultLabels merges labels of all providers; defaults of upper providers win
+func (layered *LayeredProperties) GetDefaultLabels() map[string]string {
+	result := make(map[string]string)
+	for i := len(layered.providers) - 1; i >= 0; i-- {
+		for name, value := range layered.providers[i].GetDefaultLabels() {
+			result[name] = value
+		}
+	}
+	return result
+}
@@ -0,0 +1,62 @@
+package devices
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLayeredProperties_GetProperties(t *testing.T) {
+	//given
+	dir, _ := ioutil.TempDir("", "naming")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "naming.yaml")
+	writeConfiguration(t, file, "room:\n  - device: plug_01\n    name: Configured\n")
+	configured, _ := NewProperties(file)
+	learned := NewAutoProperties()
+	learned.Learn("plug_01", "Learned 1")
+	learned.Learn("plug_02", "Learned 2")
+	layered := NewLayeredProperties(configured, learned)
+	tests := []struct {
+		device string
+		want   string
+		found  bool
+	}{
+		{"plug_01", "Configured", true},
+		{"plug_02", "Learned 2", true},
+		{"plug_03", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.device, func(t *testing.T) {
+			//when
+			result, ok := layered.GetProperties(tt.device)
+
+			//then
+			if ok != tt.found || (ok && result.Name != tt.want) {
+				t.Errorf("GetProperties() = %+v, %t, want name %q, %t", result, ok, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+func TestLayeredProperties_ListDevices(t *testing.T) {
+	//given
+	dir, _ := ioutil.TempDir("", "naming")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "naming.yaml")
+	writeConfiguration(t, file, "room:\n  - device: plug_01\n    name: Configured\n  - device: plug_*\n    name: Pattern\n")
+	configured, _ := NewProperties(file)
+	learned := NewAutoProperties()
+	learned.Learn("plug_01", "Learned 1")
+	learned.Learn("lamp", "Learned lamp")
+
+	//when
+	result := NewLayeredProperties(configured, learned).ListDevices()
+
+	//then
+	if expected := []string{"lamp", "plug_01"}; !reflect.DeepEqual(result, expected) {
+		t.Errorf("ListDevices() = %v, want %v", result, expected)
+	}
+}
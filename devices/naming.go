@@ -1,71 +1,242 @@
 package devices
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
-
-	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 )
 
+// maxCachedDevices is size of device lookup cache; it is cleared when full, as lookups can simply be repeated
+const maxCachedDevices = 10000
+
 type Properties struct {
-	Device  string
-	Name    string
-	Group   string
-	Sensors map[string]string
+	Device         string
+	Name           string
+	Group          string
+	Sensors        map[string]string
+	Labels         map[string]string
+	SensorSettings map[string]SensorSettings
 }
 type Configuration map[string]Properties
 
-var configuration = Configuration(nil)
-
-func loadConfiguration(file string) Configuration {
-	type YamlDevice struct {
-		Device  string            `yaml:"device"`
-		Name    string            `yaml:"name"`
-		Sensors map[string]string `yaml:"sensors"`
+func (configuration Configuration) deviceNames() []string {
+	result := make([]string, 0, len(configuration))
+	for device := range configuration {
+		result = append(result, device)
 	}
+	sort.Strings(result)
+	return result
+}
 
-	type YamlConfiguration map[string][]YamlDevice
+// LabelDefaults holds custom label names declared in naming configuration with their default values
+type LabelDefaults map[string]string
 
-	data, err := ioutil.ReadFile(file)
-	if err != nil {
-		panic(err)
+type namingConfiguration struct {
+	devices  Configuration
+	patterns []devicePattern
+	labels   LabelDefaults
+}
+
+func (configuration *namingConfiguration) lookup(deviceName string) (*Properties, bool) {
+	if device, ok := configuration.devices[deviceName]; ok {
+		return &Properties{device.Device, device.Name, device.Group, device.Sensors, device.Labels, device.SensorSettings}, true
 	}
-	configuration := YamlConfiguration{}
-	err = yaml.Unmarshal(data, &configuration)
-	if err != nil {
-		panic(err)
+	for _, pattern := range configuration.patterns {
+		if properties, ok := pattern.match(deviceName); ok {
+			return properties, true
+		}
 	}
+	return nil, false
+}
 
-	result := Configuration{}
+// readConfiguration reads naming configuration from a file, a directory or files matching a glob
+func readConfiguration(source string) (*namingConfiguration, error) {
+	files, err := configurationFiles(source)
+	if err != nil {
+		return nil, err
+	}
+	documents := make([]configurationFile, len(files))
+	for i, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		documents[i] = configurationFile{name: file, data: data}
+	}
+	return parseConfigurationFiles(documents)
+}
 
-	for group := range configuration {
-		devices := configuration[group]
-		for i := range devices {
-			device := devices[i]
-			var sensors map[string]string
-			if sensors = device.Sensors; sensors == nil {
-				sensors = make(map[string]string, 0)
+// configurationFiles lists files of naming configuration source; for directory these are all its *.yaml and *.yml files
+func configurationFiles(source string) ([]string, error) {
+	var files []string
+	if isGlob(source) {
+		matches, err := filepath.Glob(source)
+		if err != nil {
+			return nil, err
+		}
+		files = matches
+	} else {
+		info, err := os.Stat(source)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return []string{source}, nil
+		}
+		entries, err := ioutil.ReadDir(source)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && isConfigurationFile(entry.Name()) {
+				files = append(files, filepath.Join(source, entry.Name()))
 			}
-
-			result[device.Device] = Properties{device.Device, device.Name, group, sensors}
 		}
 	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no naming configuration files found in %s", source)
+	}
+	sort.Strings(files)
+	return files, nil
+}
 
-	return result
+func isGlob(source string) bool {
+	return strings.ContainsAny(source, globChars)
+}
+
+// isConfigurationFile skips hidden files, e.g. editor swap files and kubernetes ConfigMap internals
+func isConfigurationFile(name string) bool {
+	extension := filepath.Ext(name)
+	return !strings.HasPrefix(name, ".") && (extension == ".yaml" || extension == ".yml")
+}
+
+// CheckConfiguration validates naming configuration without loading it
+func CheckConfiguration(source string) error {
+	_, err := readConfiguration(source)
+	return err
+}
+
+type cachedProperties struct {
+	properties *Properties
+	found      bool
+}
+
+type PropertiesProvider struct {
+	configFile    string
+	lock          sync.RWMutex
+	configuration *namingConfiguration
+	cache         map[string]cachedProperties
 }
 
-type PropertiesProvider struct{}
+func NewProperties(configFile string) (*PropertiesProvider, error) {
+	configuration, err := readConfiguration(configFile)
+	if err != nil {
+		return nil, err
+	}
+	return &PropertiesProvider{
+		configFile:    configFile,
+		configuration: configuration,
+		cache:         make(map[string]cachedProperties),
+	}, nil
+}
 
-func NewProperties(configFile string) *PropertiesProvider {
-	if configuration == nil {
-		configuration = loadConfiguration(configFile)
+// Reload reads configuration file again and swaps it only when it is valid.
+// Returns names of devices which were added, removed or changed.
+func (provider *PropertiesProvider) Reload() ([]string, error) {
+	configuration, err := readConfiguration(provider.configFile)
+	if err != nil {
+		return nil, err
+	}
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+	if !reflect.DeepEqual(provider.configuration.labels, configuration.labels) {
+		// label names are part of every registered metric and defaults are copied by metrics store, so they can not change at runtime
+		return nil, errors.New("declared labels can not be changed without restart")
 	}
-	return &PropertiesProvider{}
+	previous := provider.configuration
+	provider.configuration = configuration
+	changed := changedDevices(previous.devices, configuration.devices)
+	changed = append(changed, changedCachedDevices(provider.cache, configuration, changed)...)
+	provider.cache = make(map[string]cachedProperties)
+	return changed, nil
 }
 
-func (*PropertiesProvider) GetProperties(deviceName string) (*Properties, bool) {
-	device, ok := configuration[deviceName]
+func changedDevices(previous Configuration, current Configuration) (changed []string) {
+	for device, properties := range previous {
+		if currentProperties, ok := current[device]; !ok || !reflect.DeepEqual(properties, currentProperties) {
+			changed = append(changed, device)
+		}
+	}
+	for device := range current {
+		if _, ok := previous[device]; !ok {
+			changed = append(changed, device)
+		}
+	}
+	return
+}
+
+// changedCachedDevices finds already seen devices which resolve differently with new configuration (e.g. matched by changed pattern)
+func changedCachedDevices(cache map[string]cachedProperties, configuration *namingConfiguration, alreadyChanged []string) (changed []string) {
+	skip := make(map[string]bool, len(alreadyChanged))
+	for _, device := range alreadyChanged {
+		skip[device] = true
+	}
+	for device, cached := range cache {
+		if skip[device] {
+			continue
+		}
+		properties, found := configuration.lookup(device)
+		if found != cached.found || !reflect.DeepEqual(properties, cached.properties) {
+			changed = append(changed, device)
+		}
+	}
+	return
+}
+
+func (provider *PropertiesProvider) GetProperties(deviceName string) (*Properties, bool) {
+	provider.lock.RLock()
+	cached, ok := provider.cache[deviceName]
+	configuration := provider.configuration
+	provider.lock.RUnlock()
 	if !ok {
+		properties, found := configuration.lookup(deviceName)
+		cached = cachedProperties{properties: properties, found: found}
+		provider.lock.Lock()
+		if provider.configuration == configuration {
+			if len(provider.cache) >= maxCachedDevices {
+				provider.cache = make(map[string]cachedProperties)
+			}
+			provider.cache[deviceName] = cached
+		}
+		provider.lock.Unlock()
+	}
+	if !cached.found {
 		return nil, false
 	}
-	return &Properties{device.Device, device.Name, device.Group, device.Sensors}, true
+	properties := *cached.properties
+	return &properties, true
+}
+
+// ListDevices returns devices listed by name in naming configuration; devices matched by patterns are not known up front
+func (provider *PropertiesProvider) ListDevices() []string {
+	provider.lock.RLock()
+	defer provider.lock.RUnlock()
+	return provider.configuration.devices.deviceNames()
+}
+
+// GetDefaultLabels returns custom label names with their default values
+func (provider *PropertiesProvider) GetDefaultLabels() map[string]string {
+	provider.lock.RLock()
+	defer provider.lock.RUnlock()
+	result := make(map[string]string, len(provider.configuration.labels))
+	for name, value := range provider.configuration.labels {
+		result[name] = value
+	}
+	return result
 }
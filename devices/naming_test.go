@@ -1,14 +1,27 @@
 package devices
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"testing"
 )
 
 var inputFile = "./testdata/sampleConfiguration.yaml"
 
+func mustReadConfiguration(t *testing.T, file string) Configuration {
+	result, err := readConfiguration(file)
+	if err != nil {
+		t.Fatalf("could not read configuration: %v", err)
+	}
+	return result.devices
+}
+
 func Test_loadConfiguration_groups(t *testing.T) {
 	//when
-	result := loadConfiguration(inputFile)
+	result := mustReadConfiguration(t, inputFile)
 
 	//then
 	_, ok := result["dev1"]
@@ -23,7 +36,7 @@ func Test_loadConfiguration_devices(t *testing.T) {
 	expectedCount := 4
 
 	//when
-	result := loadConfiguration(inputFile)
+	result := mustReadConfiguration(t, inputFile)
 
 	//then
 	if len(result) != expectedCount {
@@ -33,7 +46,7 @@ func Test_loadConfiguration_devices(t *testing.T) {
 
 func Test_loadConfiguration_correctResult(t *testing.T) {
 	//when
-	configuration := loadConfiguration(inputFile)
+	configuration := mustReadConfiguration(t, inputFile)
 
 	//then
 	result, _ := configuration["dev1"]
@@ -56,17 +69,17 @@ func Test_loadConfiguration_correctResult(t *testing.T) {
 
 func Test_NewNamer_loadConfig(t *testing.T) {
 	//when
-	_ = NewProperties(inputFile)
+	namer, _ := NewProperties(inputFile)
 
 	//then
-	if configuration == nil {
+	if namer.configuration == nil {
 		t.Errorf("configuration was not loaded")
 	}
 }
 
 func Test_TranslateDevice(t *testing.T) {
 	//given
-	namer := NewProperties(inputFile)
+	namer, _ := NewProperties(inputFile)
 
 	//when
 	result, ok := namer.GetProperties("dev3")
@@ -92,7 +105,7 @@ func Test_TranslateDevice(t *testing.T) {
 
 func Test_TranslateDevice_deviceNotFound(t *testing.T) {
 	//given
-	namer := NewProperties(inputFile)
+	namer, _ := NewProperties(inputFile)
 
 	//when
 	_, ok := namer.GetProperties("not existing")
@@ -102,3 +115,198 @@ func Test_TranslateDevice_deviceNotFound(t *testing.T) {
 		t.Errorf("device should NOT be found")
 	}
 }
+
+func writeConfiguration(t *testing.T, file string, content string) {
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("could not write configuration: %v", err)
+	}
+}
+
+func Test_Reload(t *testing.T) {
+	//given
+	dir, _ := ioutil.TempDir("", "naming")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "naming.yaml")
+	writeConfiguration(t, file, "room:\n  - device: dev1\n    name: d1\n  - device: dev2\n    name: d2\n")
+	namer, _ := NewProperties(file)
+	writeConfiguration(t, file, "room:\n  - device: dev1\n    name: d1\n  - device: dev2\n    name: renamed\n  - device: dev3\n    name: d3\n")
+
+	//when
+	changed, err := namer.Reload()
+
+	//then
+	sort.Strings(changed)
+	if err != nil || !reflect.DeepEqual(changed, []string{"dev2", "dev3"}) {
+		t.Errorf("Reload() => changed: %+v (expected: [dev2 dev3]), error: %v", changed, err)
+	}
+	if result, ok := namer.GetProperties("dev2"); !ok || result.Name != "renamed" {
+		t.Errorf("Reload() => configuration was not swapped, got: %+v", result)
+	}
+}
+
+func Test_Reload_invalidKeepsPrevious(t *testing.T) {
+	//given
+	dir, _ := ioutil.TempDir("", "naming")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "naming.yaml")
+	writeConfiguration(t, file, "room:\n  - device: dev1\n    name: d1\n")
+	namer, _ := NewProperties(file)
+	writeConfiguration(t, file, "room: [ - device")
+
+	//when
+	_, err := namer.Reload()
+
+	//then
+	if err == nil {
+		t.Errorf("Reload() => expected error for invalid configuration")
+	}
+	if _, ok := namer.GetProperties("dev1"); !ok {
+		t.Errorf("Reload() => previous configuration should be kept")
+	}
+}
+
+func Test_changedDevices(t *testing.T) {
+	//given
+	previous := Configuration{
+		"same":    {Device: "same", Name: "n", Sensors: map[string]string{"s": "a"}},
+		"sensor":  {Device: "sensor", Name: "n", Sensors: map[string]string{"s": "a"}},
+		"removed": {Device: "removed", Name: "n"},
+	}
+	current := Configuration{
+		"same":   {Device: "same", Name: "n", Sensors: map[string]string{"s": "a"}},
+		"sensor": {Device: "sensor", Name: "n", Sensors: map[string]string{"s": "b"}},
+		"added":  {Device: "added", Name: "n"},
+	}
+
+	//when
+	result := changedDevices(previous, current)
+
+	//then
+	sort.Strings(result)
+	if expected := []string{"added", "removed", "sensor"}; !reflect.DeepEqual(result, expected) {
+		t.Errorf("changedDevices() = %+v, want %+v", result, expected)
+	}
+}
+
+func Test_Reload_labelsChanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels string
+	}{
+		{"name changed", "labels:\n  room: \"\"\n"},
+		{"name added", "labels:\n  floor: \"\"\n  room: \"\"\n"},
+		{"default changed", "labels:\n  floor: ground\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//given
+			dir, _ := ioutil.TempDir("", "naming")
+			defer os.RemoveAll(dir)
+			file := filepath.Join(dir, "naming.yaml")
+			writeConfiguration(t, file, "labels:\n  floor: \"\"\nroom:\n  - device: dev1\n    name: d1\n")
+			namer, _ := NewProperties(file)
+			writeConfiguration(t, file, tt.labels+"room:\n  - device: dev1\n    name: d1\n")
+
+			//when
+			_, err := namer.Reload()
+
+			//then
+			if err == nil || err.Error() != "declared labels can not be changed without restart" {
+				t.Errorf("Reload() => error = %v, expected error when declared labels change", err)
+			}
+			if labels := namer.GetDefaultLabels(); !reflect.DeepEqual(labels, map[string]string{"floor": ""}) {
+				t.Errorf("Reload() => previous labels should be kept, got: %+v", labels)
+			}
+		})
+	}
+}
+
+func Test_Reload_patternMatchedDevices(t *testing.T) {
+	//given
+	dir, _ := ioutil.TempDir("", "naming")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "naming.yaml")
+	writeConfiguration(t, file, "room:\n  - device: plug_*\n    name: Plug $1\n  - device: lamp\n    name: Lamp\n")
+	namer, _ := NewProperties(file)
+	namer.GetProperties("plug_01")
+	namer.GetProperties("lamp")
+	writeConfiguration(t, file, "room:\n  - device: plug_*\n    name: Socket $1\n  - device: lamp\n    name: Lamp\n")
+
+	//when
+	changed, err := namer.Reload()
+
+	//then
+	if err != nil || !reflect.DeepEqual(changed, []string{"plug_01"}) {
+		t.Errorf("Reload() => changed: %+v (expected: [plug_01]), error: %v", changed, err)
+	}
+	if result, ok := namer.GetProperties("plug_01"); !ok || result.Name != "Socket 01" {
+		t.Errorf("Reload() => cache was not invalidated, got: %+v", result)
+	}
+}
+
+func Test_configurationFiles(t *testing.T) {
+	//given
+	dir, _ := ioutil.TempDir("", "naming")
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"b.yaml", "a.yml", "notes.txt", ".swap.yaml"} {
+		writeConfiguration(t, filepath.Join(dir, name), "room: []\n")
+	}
+	_ = os.Mkdir(filepath.Join(dir, "..data"), 0755)
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{"file", filepath.Join(dir, "b.yaml"), []string{filepath.Join(dir, "b.yaml")}},
+		{"directory", dir, []string{filepath.Join(dir, "a.yml"), filepath.Join(dir, "b.yaml")}},
+		{"glob", filepath.Join(dir, "*.yaml"), []string{filepath.Join(dir, ".swap.yaml"), filepath.Join(dir, "b.yaml")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//when
+			result, err := configurationFiles(tt.source)
+
+			//then
+			if err != nil || !reflect.DeepEqual(result, tt.want) {
+				t.Errorf("configurationFiles() = %+v, %v, want %+v", result, err, tt.want)
+			}
+		})
+	}
+}
+
+func Test_configurationFiles_noFiles(t *testing.T) {
+	//given
+	dir, _ := ioutil.TempDir("", "naming")
+	defer os.RemoveAll(dir)
+
+	//when
+	_, err := configurationFiles(filepath.Join(dir, "*.yaml"))
+
+	//then
+	if err == nil {
+		t.Errorf("configurationFiles() expected error when no files match")
+	}
+}
+
+func Test_NewProperties_directory(t *testing.T) {
+	//given
+	dir, _ := ioutil.TempDir("", "naming")
+	defer os.RemoveAll(dir)
+	writeConfiguration(t, filepath.Join(dir, "labels.yaml"), "labels:\n  team: \"\"\n")
+	writeConfiguration(t, filepath.Join(dir, "kitchen.yaml"), "kitchen:\n  labels:\n    team: a\n  devices:\n    - device: dev1\n      name: d1\n")
+	writeConfiguration(t, filepath.Join(dir, "garage.yaml"), "garage:\n  - device: dev2\n    name: d2\n")
+
+	//when
+	namer, err := NewProperties(dir)
+
+	//then
+	if err != nil {
+		t.Fatalf("NewProperties() unexpected error: %v", err)
+	}
+	if result, ok := namer.GetProperties("dev1"); !ok || result.Labels["team"] != "a" {
+		t.Errorf("GetProperties(dev1) = %+v, %v", result, ok)
+	}
+	if result, ok := namer.GetProperties("dev2"); !ok || result.Group != "garage" {
+		t.Errorf("GetProperties(dev2) = %+v, %v", result, ok)
+	}
+}
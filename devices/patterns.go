@@ -0,0 +1,88 @@
+package devices
+
+import (
+	"regexp"
+	"strings"
+)
+
+// regexChars mark device as regular expression; glob wildcards alone mark it as glob pattern
+const (
+	regexChars = `(\+{|^$`
+	globChars  = `*?[`
+)
+
+// devicePattern matches device names against regular expression; its capture groups can be used
+// in name, sensor aliases, sensor locations and labels as $1, ${1} or $name
+type devicePattern struct {
+	pattern    *regexp.Regexp
+	properties Properties
+}
+
+func (dp devicePattern) match(deviceName string) (*Properties, bool) {
+	submatches := dp.pattern.FindStringSubmatchIndex(deviceName)
+	if submatches == nil {
+		return nil, false
+	}
+	expand := func(template string) string {
+		return string(dp.pattern.ExpandString(nil, template, deviceName, submatches))
+	}
+	sensors := make(map[string]string, len(dp.properties.Sensors))
+	for sensor, alias := range dp.properties.Sensors {
+		sensors[sensor] = expand(alias)
+	}
+	labels := make(map[string]string, len(dp.properties.Labels))
+	for name, value := range dp.properties.Labels {
+		labels[name] = expand(value)
+	}
+	sensorSettings := make(map[string]SensorSettings, len(dp.properties.SensorSettings))
+	for sensor, settings := range dp.properties.SensorSettings {
+		settings.Location = expand(settings.Location)
+		sensorSettings[sensor] = settings
+	}
+	return &Properties{deviceName, expand(dp.properties.Name), dp.properties.Group, sensors, labels, sensorSettings}, true
+}
+
+func isPattern(device string) bool {
+	return strings.ContainsAny(device, regexChars) || strings.ContainsAny(device, globChars)
+}
+
+// compileDevicePattern compiles device entry into regular expression matching whole device name
+func compileDevicePattern(device string) (*regexp.Regexp, error) {
+	if strings.ContainsAny(device, regexChars) {
+		return regexp.Compile(`^(?:` + device + `)$`)
+	}
+	return regexp.Compile(`^` + globToRegex(device) + `$`)
+}
+
+// globToRegex converts glob into regular expression with every wildcard being a capture group
+func globToRegex(glob string) string {
+	var builder strings.Builder
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '*':
+			builder.WriteString("(.*)")
+		case '?':
+			builder.WriteString("(.)")
+		case '[':
+			end := i + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end == len(runes) {
+				builder.WriteString(regexp.QuoteMeta(string(runes[i:])))
+				i = end
+				continue
+			}
+			class := string(runes[i+1 : end])
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			builder.WriteString("([" + strings.Replace(class, `\`, `\\`, -1) + "])")
+			i = end
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(runes[i])))
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,87 @@
+package devices
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_globToRegex(t *testing.T) {
+	tests := []struct {
+		glob string
+		want string
+	}{
+		{"plug_kitchen_*", `plug_kitchen_(.*)`},
+		{"plug_?", `plug_(.)`},
+		{"plug_[0-9]_[!a]", `plug_([0-9])_([^a])`},
+		{"plug.[x", `plug\.\[x`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob, func(t *testing.T) {
+			if got := globToRegex(tt.glob); got != tt.want {
+				t.Errorf("globToRegex() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isPattern(t *testing.T) {
+	tests := []struct {
+		device string
+		want   bool
+	}{
+		{"plug_kitchen_01", false},
+		{"plug-kitchen.01", false},
+		{"plug_kitchen_*", true},
+		{"plug_(\\w+)", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.device, func(t *testing.T) {
+			if got := isPattern(tt.device); got != tt.want {
+				t.Errorf("isPattern() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseConfiguration_patterns(t *testing.T) {
+	//given
+	input := `labels:
+  room: ""
+plugs:
+  - device: plug_kitchen_05
+    name: Kettle
+  - device: plug_kitchen_*
+    name: Kitchen plug $1
+  - device: plug_(?P<room>\w+)_(\d+)
+    name: Plug $2
+    sensors:
+      ENERGY: energy_$2
+    labels:
+      room: $room
+`
+	configuration, err := parseConfiguration("naming.yaml", []byte(input))
+	if err != nil {
+		t.Fatalf("parseConfiguration() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		device string
+		want   *Properties
+	}{
+		{"plug_kitchen_05", &Properties{"plug_kitchen_05", "Kettle", "plugs", map[string]string{}, map[string]string{"room": ""}, map[string]SensorSettings{}}},
+		{"plug_kitchen_07", &Properties{"plug_kitchen_07", "Kitchen plug 07", "plugs", map[string]string{}, map[string]string{"room": ""}, map[string]SensorSettings{}}},
+		{"plug_garage_12", &Properties{"plug_garage_12", "Plug 12", "plugs", map[string]string{"ENERGY": "energy_12"}, map[string]string{"room": "garage"}, map[string]SensorSettings{}}},
+		{"plug_garage", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.device, func(t *testing.T) {
+			//when
+			result, ok := configuration.lookup(tt.device)
+
+			//then
+			if ok != (tt.want != nil) || !reflect.DeepEqual(result, tt.want) {
+				t.Errorf("lookup() = %+v, %v, want %+v", result, ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package devices
+
+// SensorSettings holds optional configuration of device sensor beyond its alias.
+// Readouts are calibrated as value*Scale + Offset; Fields override settings of single readout (e.g. "Pressure").
+type SensorSettings struct {
+	Location string
+	Enabled  bool
+	Offset   float64
+	Scale    float64
+	Fields   map[string]FieldSettings
+}
+
+// FieldSettings holds settings of single sensor readout, already merged with settings of its sensor
+type FieldSettings struct {
+	Enabled bool
+	Offset  float64
+	Scale   float64
+}
+
+func defaultSensorSettings() SensorSettings {
+	return SensorSettings{Enabled: true, Scale: 1, Fields: make(map[string]FieldSettings)}
+}
+
+// Apply calibrates readout of given field; returns false when sensor or field is disabled
+func (settings SensorSettings) Apply(field string, value float64) (float64, bool) {
+	if !settings.Enabled {
+		return 0, false
+	}
+	if fieldSettings, ok := settings.Fields[field]; ok {
+		if !fieldSettings.Enabled {
+			return 0, false
+		}
+		return value*fieldSettings.Scale + fieldSettings.Offset, true
+	}
+	return value*settings.Scale + settings.Offset, true
+}
@@ -0,0 +1,31 @@
+package devices
+
+import "testing"
+
+func TestSensorSettings_Apply(t *testing.T) {
+	settings := SensorSettings{Enabled: true, Offset: -0.5, Scale: 2, Fields: map[string]FieldSettings{
+		"Pressure": {Enabled: false, Offset: -0.5, Scale: 2},
+		"Humidity": {Enabled: true, Offset: 3, Scale: 1},
+	}}
+	tests := []struct {
+		name      string
+		settings  SensorSettings
+		field     string
+		wantValue float64
+		wantOk    bool
+	}{
+		{"sensor settings", settings, "Temperature", 41.5, true},
+		{"field override", settings, "Humidity", 24, true},
+		{"disabled field", settings, "Pressure", 0, false},
+		{"disabled sensor", SensorSettings{Enabled: false, Scale: 1}, "Temperature", 0, false},
+		{"defaults", defaultSensorSettings(), "Temperature", 21, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, ok := tt.settings.Apply(tt.field, 21)
+			if value != tt.wantValue || ok != tt.wantOk {
+				t.Errorf("Apply() = %v, %v, want %v, %v", value, ok, tt.wantValue, tt.wantOk)
+			}
+		})
+	}
+}
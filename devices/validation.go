@@ -0,0 +1,463 @@
+package devices
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError describes single problem found in naming configuration
+type ValidationError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (err ValidationError) Error() string {
+	if err.Line == 0 {
+		return fmt.Sprintf("%s: %s", err.File, err.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", err.File, err.Line, err.Message)
+}
+
+// ValidationErrors holds all problems found in naming configuration, ordered by line
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+type yamlDevice struct {
+	Device  string            `yaml:"device"`
+	Name    string            `yaml:"name"`
+	Sensors yaml.Node         `yaml:"sensors"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+type yamlSensor struct {
+	Alias    string                     `yaml:"alias"`
+	Location string                     `yaml:"location"`
+	Enabled  *bool                      `yaml:"enabled"`
+	Offset   float64                    `yaml:"offset"`
+	Scale    *float64                   `yaml:"scale"`
+	Fields   map[string]yamlSensorField `yaml:"fields"`
+}
+
+type yamlSensorField struct {
+	Enabled *bool    `yaml:"enabled"`
+	Offset  *float64 `yaml:"offset"`
+	Scale   *float64 `yaml:"scale"`
+}
+
+// labelsKey is a reserved top level key declaring custom labels with their default values
+const labelsKey = "labels"
+
+var knownDeviceFields = map[string]bool{"device": true, "name": true, "sensors": true, "labels": true}
+var knownSensorFields = map[string]bool{"alias": true, "location": true, "enabled": true, "offset": true, "scale": true, "fields": true}
+var knownSensorFieldSettings = map[string]bool{"enabled": true, "offset": true, "scale": true}
+var labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedLabelNames are set by exporter itself and can not be used as custom labels
+var reservedLabelNames = map[string]bool{"device": true, "group": true, "friendly_name": true, "sensor_name": true, "sensor_alias": true, "sensor_location": true}
+
+// configurationFile is single document of naming configuration, which can be split across many files
+type configurationFile struct {
+	name string
+	data []byte
+}
+
+// location points to definition in one of configuration files
+type location struct {
+	file string
+	line int
+}
+
+// describe returns location as seen from given file
+func (l location) describe(file string) string {
+	if l.file == file {
+		return fmt.Sprintf("line %d", l.line)
+	}
+	return fmt.Sprintf("%s:%d", l.file, l.line)
+}
+
+type configurationParser struct {
+	file            string
+	errors          ValidationErrors
+	deviceLocations map[string]location
+	labels          LabelDefaults
+	labelLocations  map[string]location
+}
+
+func newConfigurationParser() *configurationParser {
+	return &configurationParser{
+		deviceLocations: make(map[string]location),
+		labels:          LabelDefaults{},
+		labelLocations:  make(map[string]location),
+	}
+}
+
+func (parser *configurationParser) at(line int) location {
+	return location{file: parser.file, line: line}
+}
+
+func (parser *configurationParser) fail(line int, message string, v ...interface{}) {
+	parser.errors = append(parser.errors, ValidationError{File: parser.file, Line: line, Message: fmt.Sprintf(message, v...)})
+}
+
+// parseConfiguration converts naming configuration document into Configuration, reporting all problems found at once
+func parseConfiguration(file string, data []byte) (*namingConfiguration, error) {
+	return parseConfigurationFiles([]configurationFile{{name: file, data: data}})
+}
+
+// parseConfigurationFiles merges naming configuration documents; devices, group names and labels
+// are checked for conflicts across all files
+func parseConfigurationFiles(files []configurationFile) (*namingConfiguration, error) {
+	parser := newConfigurationParser()
+	result := &namingConfiguration{devices: Configuration{}, labels: parser.labels}
+
+	roots := make([]*yaml.Node, len(files))
+	for i, file := range files {
+		parser.file = file.name
+		roots[i] = parser.parseDocument(file.data)
+		if roots[i] == nil {
+			continue
+		}
+		for j := 0; j+1 < len(roots[i].Content); j += 2 {
+			if roots[i].Content[j].Value == labelsKey {
+				parser.parseLabelDeclarations(roots[i].Content[j+1])
+			}
+		}
+	}
+
+	for i, root := range roots {
+		if root == nil {
+			continue
+		}
+		parser.file = files[i].name
+		parser.parseGroups(root, result)
+	}
+
+	if len(parser.errors) > 0 {
+		order := make(map[string]int, len(files))
+		for i, file := range files {
+			order[file.name] = i
+		}
+		sort.SliceStable(parser.errors, func(i, j int) bool {
+			if parser.errors[i].File != parser.errors[j].File {
+				return order[parser.errors[i].File] < order[parser.errors[j].File]
+			}
+			return parser.errors[i].Line < parser.errors[j].Line
+		})
+		return nil, parser.errors
+	}
+	return result, nil
+}
+
+// parseDocument returns root mapping of the document, or nil when it is empty or invalid
+func (parser *configurationParser) parseDocument(data []byte) *yaml.Node {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		parser.fail(0, "%v", err)
+		return nil
+	}
+	if len(document.Content) == 0 {
+		return nil
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		parser.fail(root.Line, "expected mapping of groups")
+		return nil
+	}
+	return root
+}
+
+func (parser *configurationParser) parseGroups(root *yaml.Node, result *namingConfiguration) {
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		group, node := root.Content[i].Value, root.Content[i+1]
+		if group == labelsKey {
+			continue
+		}
+		devices, groupLabels, ok := parser.parseGroup(group, node)
+		if !ok {
+			continue
+		}
+		for _, node := range devices.Content {
+			properties, ok := parser.parseDevice(group, groupLabels, node)
+			if !ok {
+				continue
+			}
+			if isPattern(properties.Device) {
+				pattern, err := compileDevicePattern(properties.Device)
+				if err != nil {
+					parser.fail(keyLine(node, "device"), "device %q: invalid pattern: %v", properties.Device, err)
+					continue
+				}
+				result.patterns = append(result.patterns, devicePattern{pattern: pattern, properties: properties})
+				continue
+			}
+			result.devices[properties.Device] = properties
+		}
+	}
+}
+
+func (parser *configurationParser) parseLabelDeclarations(node *yaml.Node) {
+	var labels map[string]string
+	if err := node.Decode(&labels); err != nil {
+		parser.fail(node.Line, "labels: expected mapping of label names to default values")
+		return
+	}
+	for name, value := range labels {
+		if !labelNameRegex.MatchString(name) || strings.HasPrefix(name, "__") {
+			parser.fail(keyLine(node, name), "invalid label name %q", name)
+			continue
+		}
+		if reservedLabelNames[name] {
+			parser.fail(keyLine(node, name), "label name %q is reserved", name)
+			continue
+		}
+		if previous, ok := parser.labelLocations[name]; ok {
+			if parser.labels[name] != value {
+				parser.fail(keyLine(node, name), "label %q declared with default %q, but already declared with default %q in %s", name, value, parser.labels[name], previous.describe(parser.file))
+			}
+			continue
+		}
+		parser.labels[name] = value
+		parser.labelLocations[name] = parser.at(keyLine(node, name))
+	}
+}
+
+// parseGroup accepts plain list of devices or mapping with "devices" list and group "labels"
+func (parser *configurationParser) parseGroup(group string, node *yaml.Node) (*yaml.Node, map[string]string, bool) {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		return node, nil, true
+	case yaml.MappingNode:
+		var devices *yaml.Node
+		var labels map[string]string
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			switch key.Value {
+			case "devices":
+				devices = value
+			case "labels":
+				if err := value.Decode(&labels); err != nil {
+					parser.fail(value.Line, "group %q: expected mapping of labels", group)
+					return nil, nil, false
+				}
+				parser.validateLabels(fmt.Sprintf("group %q", group), value, labels)
+			default:
+				parser.fail(key.Line, "unknown field %q", key.Value)
+			}
+		}
+		if devices != nil && devices.Kind == yaml.SequenceNode {
+			return devices, labels, true
+		}
+	}
+	parser.fail(node.Line, "group %q: expected list of devices", group)
+	return nil, nil, false
+}
+
+func (parser *configurationParser) validateLabels(owner string, node *yaml.Node, labels map[string]string) bool {
+	valid := true
+	for name := range labels {
+		if _, ok := parser.labels[name]; !ok {
+			parser.fail(keyLine(node, name), "%s: label %q is not declared in top level \"labels\"", owner, name)
+			valid = false
+		}
+	}
+	return valid
+}
+
+// resolveLabels merges declared defaults, group and device labels; the most specific one wins
+func (parser *configurationParser) resolveLabels(groupLabels map[string]string, deviceLabels map[string]string) map[string]string {
+	result := make(map[string]string, len(parser.labels))
+	for _, labels := range []map[string]string{parser.labels, groupLabels, deviceLabels} {
+		for name, value := range labels {
+			if _, ok := parser.labels[name]; ok {
+				result[name] = value
+			}
+		}
+	}
+	return result
+}
+
+func (parser *configurationParser) parseDevice(group string, groupLabels map[string]string, node *yaml.Node) (Properties, bool) {
+	if node.Kind != yaml.MappingNode {
+		parser.fail(node.Line, "group %q: expected device definition", group)
+		return Properties{}, false
+	}
+	parser.checkFields(node, knownDeviceFields)
+	var device yamlDevice
+	if err := node.Decode(&device); err != nil {
+		parser.fail(node.Line, "%v", err)
+		return Properties{}, false
+	}
+
+	valid := true
+	if strings.TrimSpace(device.Device) == "" {
+		parser.fail(node.Line, "group %q: empty device", group)
+		valid = false
+	} else if previous, ok := parser.deviceLocations[device.Device]; ok {
+		parser.fail(node.Line, "duplicate device %q (already defined in %s)", device.Device, previous.describe(parser.file))
+		valid = false
+	} else {
+		parser.deviceLocations[device.Device] = parser.at(node.Line)
+	}
+	if strings.TrimSpace(device.Name) == "" {
+		parser.fail(node.Line, "device %q: empty name", device.Device)
+		valid = false
+	}
+
+	sensors, sensorSettings, ok := parser.parseSensors(device.Device, &device.Sensors)
+	if !ok || !parser.validateSensors(device.Device, node, sensors) {
+		valid = false
+	}
+
+	if device.Labels != nil && !parser.validateLabels(fmt.Sprintf("device %q", device.Device), fieldNode(node, "labels"), device.Labels) {
+		valid = false
+	}
+
+	return Properties{device.Device, device.Name, group, sensors, parser.resolveLabels(groupLabels, device.Labels), sensorSettings}, valid
+}
+
+func (parser *configurationParser) checkFields(node *yaml.Node, known map[string]bool) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if key := node.Content[i]; !known[key.Value] {
+			parser.fail(key.Line, "unknown field %q", key.Value)
+		}
+	}
+}
+
+// parseSensors accepts for every sensor either its alias or mapping with alias and sensor settings
+func (parser *configurationParser) parseSensors(device string, node *yaml.Node) (map[string]string, map[string]SensorSettings, bool) {
+	aliases := make(map[string]string, 0)
+	settings := make(map[string]SensorSettings, 0)
+	if node.Kind == 0 {
+		return aliases, settings, true
+	}
+	if node.Kind != yaml.MappingNode {
+		parser.fail(node.Line, "device %q: expected mapping of sensors", device)
+		return aliases, settings, false
+	}
+
+	valid := true
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		sensor, value := node.Content[i].Value, node.Content[i+1]
+		if value.Kind == yaml.ScalarNode {
+			aliases[sensor] = value.Value
+			continue
+		}
+		sensorSettings, alias, ok := parser.parseSensorSettings(device, sensor, value)
+		if !ok {
+			valid = false
+			continue
+		}
+		if alias != "" {
+			aliases[sensor] = alias
+		}
+		settings[sensor] = sensorSettings
+	}
+	return aliases, settings, valid
+}
+
+func (parser *configurationParser) parseSensorSettings(device string, sensor string, node *yaml.Node) (SensorSettings, string, bool) {
+	if node.Kind != yaml.MappingNode {
+		parser.fail(node.Line, "device %q: sensor %q: expected alias or mapping of settings", device, sensor)
+		return SensorSettings{}, "", false
+	}
+	parser.checkFields(node, knownSensorFields)
+	var input yamlSensor
+	if err := node.Decode(&input); err != nil {
+		parser.fail(node.Line, "device %q: sensor %q: %v", device, sensor, err)
+		return SensorSettings{}, "", false
+	}
+
+	valid := true
+	settings := defaultSensorSettings()
+	settings.Location = input.Location
+	settings.Offset = input.Offset
+	if input.Enabled != nil {
+		settings.Enabled = *input.Enabled
+	}
+	if input.Scale != nil {
+		if *input.Scale == 0 {
+			parser.fail(keyLine(node, "scale"), "device %q: sensor %q: scale can not be 0", device, sensor)
+			valid = false
+		}
+		settings.Scale = *input.Scale
+	}
+
+	fields := fieldNode(node, "fields")
+	for field, fieldInput := range input.Fields {
+		fieldNode := fieldNode(fields, field)
+		parser.checkFields(fieldNode, knownSensorFieldSettings)
+		fieldSettings := FieldSettings{Enabled: true, Offset: settings.Offset, Scale: settings.Scale}
+		if fieldInput.Enabled != nil {
+			fieldSettings.Enabled = *fieldInput.Enabled
+		}
+		if fieldInput.Offset != nil {
+			fieldSettings.Offset = *fieldInput.Offset
+		}
+		if fieldInput.Scale != nil {
+			if *fieldInput.Scale == 0 {
+				parser.fail(keyLine(fieldNode, "scale"), "device %q: sensor %q: field %q: scale can not be 0", device, sensor, field)
+				valid = false
+			}
+			fieldSettings.Scale = *fieldInput.Scale
+		}
+		settings.Fields[field] = fieldSettings
+	}
+	return settings, input.Alias, valid
+}
+
+func (parser *configurationParser) validateSensors(device string, node *yaml.Node, sensors map[string]string) bool {
+	sensorNames := make([]string, 0, len(sensors))
+	for sensor := range sensors {
+		sensorNames = append(sensorNames, sensor)
+	}
+	sort.Strings(sensorNames)
+
+	valid := true
+	aliases := make(map[string]string)
+	for _, sensor := range sensorNames {
+		alias := sensors[sensor]
+		if strings.TrimSpace(alias) == "" {
+			parser.fail(keyLine(node, "sensors"), "device %q: empty alias for sensor %q", device, sensor)
+			valid = false
+			continue
+		}
+		if other, ok := aliases[alias]; ok {
+			parser.fail(keyLine(node, "sensors"), "device %q: duplicate alias %q for sensors %q and %q", device, alias, other, sensor)
+			valid = false
+			continue
+		}
+		aliases[alias] = sensor
+	}
+	return valid
+}
+
+// keyLine returns line of given key in mapping node, or line of the node itself when key was not found
+func keyLine(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i].Line
+		}
+	}
+	return node.Line
+}
+
+func fieldNode(node *yaml.Node, field string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == field {
+			return node.Content[i+1]
+		}
+	}
+	return node
+}
@@ -0,0 +1,252 @@
+package devices
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_parseConfiguration_valid(t *testing.T) {
+	//given
+	input := "room:\n  - device: dev1\n    name: d1\n    sensors:\n      s1: sensor1\n      s2: sensor2\n"
+
+	//when
+	result, err := parseConfiguration("naming.yaml", []byte(input))
+
+	//then
+	if err != nil {
+		t.Fatalf("parseConfiguration() unexpected error: %v", err)
+	}
+	expected := Configuration{"dev1": {Device: "dev1", Name: "d1", Group: "room", Sensors: map[string]string{"s1": "sensor1", "s2": "sensor2"}, Labels: map[string]string{}, SensorSettings: map[string]SensorSettings{}}}
+	if !reflect.DeepEqual(result.devices, expected) {
+		t.Errorf("parseConfiguration() = %+v, want %+v", result.devices, expected)
+	}
+}
+
+func Test_parseConfiguration_sameNameInGroup(t *testing.T) {
+	//given
+	input := "room:\n  - device: dev1\n    name: lamp\n  - device: dev2\n    name: lamp\n"
+
+	//when
+	result, err := parseConfiguration("naming.yaml", []byte(input))
+
+	//then
+	if err != nil {
+		t.Fatalf("parseConfiguration() unexpected error: %v", err)
+	}
+	if result.devices["dev1"].Name != "lamp" || result.devices["dev2"].Name != "lamp" {
+		t.Errorf("parseConfiguration() = %+v, want both devices named lamp", result.devices)
+	}
+}
+
+func Test_parseConfiguration_errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  ValidationErrors
+	}{
+		{
+			"duplicate device across groups",
+			"room1:\n  - device: dev1\n    name: d1\nroom2:\n  - device: dev1\n    name: d2\n",
+			ValidationErrors{{"naming.yaml", 5, "duplicate device \"dev1\" (already defined in line 2)"}},
+		},
+		{
+			"empty device and name",
+			"room:\n  - device: \"\"\n    name: d1\n  - device: dev2\n",
+			ValidationErrors{
+				{"naming.yaml", 2, "group \"room\": empty device"},
+				{"naming.yaml", 4, "device \"dev2\": empty name"},
+			},
+		},
+		{
+			"duplicate alias",
+			"room:\n  - device: dev1\n    name: d1\n    sensors:\n      s1: alias\n      s2: alias\n",
+			ValidationErrors{{"naming.yaml", 4, "device \"dev1\": duplicate alias \"alias\" for sensors \"s1\" and \"s2\""}},
+		},
+		{
+			"unknown field",
+			"room:\n  - device: dev1\n    name: d1\n    sensor:\n      s1: alias\n",
+			ValidationErrors{{"naming.yaml", 4, "unknown field \"sensor\""}},
+		},
+		{
+			"invalid sensor settings",
+			"room:\n  - device: dev1\n    name: d1\n    sensors:\n      BME280:\n        scale: 0\n        fields:\n          Pressure:\n            enable: false\n",
+			ValidationErrors{
+				{"naming.yaml", 6, "device \"dev1\": sensor \"BME280\": scale can not be 0"},
+				{"naming.yaml", 9, "unknown field \"enable\""},
+			},
+		},
+		{
+			"undeclared label",
+			"room:\n  - device: dev1\n    name: d1\n    labels:\n      floor: ground\n",
+			ValidationErrors{{"naming.yaml", 5, "device \"dev1\": label \"floor\" is not declared in top level \"labels\""}},
+		},
+		{
+			"reserved label",
+			"labels:\n  group: x\n  2floor: y\nroom:\n  - device: dev1\n    name: d1\n",
+			ValidationErrors{
+				{"naming.yaml", 2, "label name \"group\" is reserved"},
+				{"naming.yaml", 3, "invalid label name \"2floor\""},
+			},
+		},
+		{
+			"invalid pattern",
+			"room:\n  - device: plug_(\\d+\n    name: d1\n",
+			ValidationErrors{{"naming.yaml", 2, "device \"plug_(\\\\d+\": invalid pattern: error parsing regexp: missing closing ): `^(?:plug_(\\d+)$`"}},
+		},
+		{
+			"group is not a list",
+			"room: dev1\n",
+			ValidationErrors{{"naming.yaml", 1, "group \"room\": expected list of devices"}},
+		},
+		{
+			"group without devices",
+			"room:\n  device: dev1\n",
+			ValidationErrors{
+				{"naming.yaml", 2, "unknown field \"device\""},
+				{"naming.yaml", 2, "group \"room\": expected list of devices"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseConfiguration("naming.yaml", []byte(tt.input))
+			if result != nil {
+				t.Errorf("parseConfiguration() = %+v, want nil", result)
+			}
+			if !reflect.DeepEqual(err, tt.want) {
+				t.Errorf("parseConfiguration() error = %#v, want %#v", err, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseConfiguration_syntaxError(t *testing.T) {
+	//when
+	_, err := parseConfiguration("naming.yaml", []byte("room: [ - device"))
+
+	//then
+	if errs, ok := err.(ValidationErrors); !ok || len(errs) != 1 || !strings.HasPrefix(errs.Error(), "naming.yaml: ") {
+		t.Errorf("parseConfiguration() error = %v, expected single ValidationError", err)
+	}
+}
+
+func Test_NewProperties_missingFile(t *testing.T) {
+	//when
+	namer, err := NewProperties("./testdata/missing.yaml")
+
+	//then
+	if err == nil || namer != nil {
+		t.Errorf("NewProperties() expected error for missing file")
+	}
+}
+
+func Test_parseConfiguration_labels(t *testing.T) {
+	//given
+	input := `labels:
+  floor: unknown
+  owner: ""
+  room: ""
+livingroom:
+  labels:
+    floor: ground
+    room: living
+  devices:
+    - device: dev1
+      name: d1
+      labels:
+        owner: alice
+    - device: dev2
+      name: d2
+bedroom:
+  - device: dev3
+    name: d3
+`
+
+	//when
+	result, err := parseConfiguration("naming.yaml", []byte(input))
+
+	//then
+	if err != nil {
+		t.Fatalf("parseConfiguration() unexpected error: %v", err)
+	}
+	if expected := (LabelDefaults{"floor": "unknown", "owner": "", "room": ""}); !reflect.DeepEqual(result.labels, expected) {
+		t.Errorf("labels = %+v, want %+v", result.labels, expected)
+	}
+	expected := map[string]map[string]string{
+		"dev1": {"floor": "ground", "owner": "alice", "room": "living"},
+		"dev2": {"floor": "ground", "owner": "", "room": "living"},
+		"dev3": {"floor": "unknown", "owner": "", "room": ""},
+	}
+	for device, want := range expected {
+		if got := result.devices[device].Labels; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s labels = %+v, want %+v", device, got, want)
+		}
+		if result.devices[device].Group == "" {
+			t.Errorf("%s group should be set", device)
+		}
+	}
+}
+
+func Test_parseConfiguration_sensorSettings(t *testing.T) {
+	//given
+	input := `room:
+  - device: dev1
+    name: d1
+    sensors:
+      SI7021: bathroom
+      BME280:
+        alias: living
+        location: shelf
+        offset: -0.5
+        fields:
+          Pressure:
+            enabled: false
+          Humidity:
+            scale: 1.1
+      BH1750:
+        enabled: false
+`
+
+	//when
+	result, err := parseConfiguration("naming.yaml", []byte(input))
+
+	//then
+	if err != nil {
+		t.Fatalf("parseConfiguration() unexpected error: %v", err)
+	}
+	device := result.devices["dev1"]
+	if expected := map[string]string{"SI7021": "bathroom", "BME280": "living"}; !reflect.DeepEqual(device.Sensors, expected) {
+		t.Errorf("sensors = %+v, want %+v", device.Sensors, expected)
+	}
+	expected := map[string]SensorSettings{
+		"BME280": {Location: "shelf", Enabled: true, Offset: -0.5, Scale: 1, Fields: map[string]FieldSettings{
+			"Pressure": {Enabled: false, Offset: -0.5, Scale: 1},
+			"Humidity": {Enabled: true, Offset: -0.5, Scale: 1.1},
+		}},
+		"BH1750": {Enabled: false, Scale: 1, Fields: map[string]FieldSettings{}},
+	}
+	if !reflect.DeepEqual(device.SensorSettings, expected) {
+		t.Errorf("sensor settings = %+v, want %+v", device.SensorSettings, expected)
+	}
+}
+
+func Test_parseConfigurationFiles_conflicts(t *testing.T) {
+	//given
+	files := []configurationFile{
+		{"a.yaml", []byte("labels:\n  team: a\nroom:\n  - device: dev1\n    name: d1\n")},
+		{"b.yaml", []byte("labels:\n  team: b\nroom:\n  - device: dev2\n    name: d1\n  - device: dev1\n    name: d3\n")},
+	}
+
+	//when
+	result, err := parseConfigurationFiles(files)
+
+	//then
+	expected := ValidationErrors{
+		{"b.yaml", 2, "label \"team\" declared with default \"b\", but already declared with default \"a\" in a.yaml:2"},
+		{"b.yaml", 6, "duplicate device \"dev1\" (already defined in a.yaml:4)"},
+	}
+	if result != nil || !reflect.DeepEqual(err, expected) {
+		t.Errorf("parseConfigurationFiles() error = %#v, want %#v", err, expected)
+	}
+}
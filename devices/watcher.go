@@ -0,0 +1,155 @@
+package devices
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/klaper_/mqtt_data_exporter/logger"
+)
+
+const watcherModuleId = "naming_watcher"
+
+// quietPeriod is how long events are coalesced before reload; single save of an editor (truncate, write, rename)
+// emits several events and reloading on the first one could read half-written file
+const quietPeriod = 200 * time.Millisecond
+
+// FileWatcher calls onChange whenever watched file (or any configuration file of watched directory or glob) changes.
+// It uses inotify and falls back to polling file modification time when inotify is not available.
+type FileWatcher struct {
+	file         string
+	directory    bool
+	pollInterval time.Duration
+	quietPeriod  time.Duration
+	onChange     func()
+	done         chan struct{}
+}
+
+func NewFileWatcher(file string, pollInterval time.Duration, onChange func()) *FileWatcher {
+	info, err := os.Stat(file)
+	return &FileWatcher{
+		file:         file,
+		directory:    err == nil && info.IsDir(),
+		pollInterval: pollInterval,
+		quietPeriod:  quietPeriod,
+		onChange:     onChange,
+		done:         make(chan struct{}),
+	}
+}
+
+// watchedDirectory returns directory in which changes are looked for
+func (fw *FileWatcher) watchedDirectory() string {
+	if fw.directory {
+		return fw.file
+	}
+	return filepath.Dir(fw.file)
+}
+
+func (fw *FileWatcher) Run() {
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		// watching directory instead of file survives editors and kubernetes ConfigMaps replacing the file
+		err = watcher.Add(fw.watchedDirectory())
+		if err != nil {
+			_ = watcher.Close()
+		}
+	}
+	if err != nil {
+		logger.Warn(watcherModuleId, "Could not use inotify for %s (%v); falling back to polling every %s", fw.file, err, fw.pollInterval)
+		go fw.poll(modificationTime(fw.file))
+		return
+	}
+	logger.Info(watcherModuleId, "Watching %s for changes", fw.file)
+	go fw.watch(watcher)
+}
+
+func (fw *FileWatcher) Close() error {
+	close(fw.done)
+	return nil
+}
+
+// watch calls onChange once relevant events stop coming for quietPeriod
+func (fw *FileWatcher) watch(watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+	var quiet <-chan time.Time
+	for {
+		select {
+		case <-fw.done:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if fw.isRelevant(event) {
+				logger.Debug(watcherModuleId, "Got %s", event)
+				quiet = time.After(fw.quietPeriod)
+			}
+		case <-quiet:
+			quiet = nil
+			fw.onChange()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Warn(watcherModuleId, "Watcher error: %v", err)
+		}
+	}
+}
+
+func (fw *FileWatcher) isRelevant(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	name := filepath.Base(event.Name)
+	// kubernetes ConfigMap volumes swap "..data" symlink instead of touching the file itself
+	if name == "..data" {
+		return true
+	}
+	if fw.directory {
+		return isConfigurationFile(name)
+	}
+	if isGlob(fw.file) {
+		matched, _ := filepath.Match(filepath.Base(fw.file), name)
+		return matched
+	}
+	return name == filepath.Base(fw.file)
+}
+
+func (fw *FileWatcher) poll(lastModification time.Time) {
+	for {
+		select {
+		case <-fw.done:
+			return
+		case <-time.After(fw.pollInterval):
+			modification := modificationTime(fw.file)
+			if !modification.Equal(lastModification) {
+				lastModification = modification
+				fw.onChange()
+			}
+		}
+	}
+}
+
+// modificationTime returns the latest modification of file, or of directory and its configuration files;
+// directory modification time changes also when a file is removed
+func modificationTime(file string) time.Time {
+	info, err := os.Stat(file)
+	if isGlob(file) {
+		info, err = os.Stat(filepath.Dir(file))
+	}
+	if err != nil {
+		return time.Time{}
+	}
+	if !info.IsDir() {
+		return info.ModTime()
+	}
+	latest := info.ModTime()
+	files, _ := configurationFiles(file)
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
@@ -0,0 +1,139 @@
+package devices
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func Test_FileWatcher_poll(t *testing.T) {
+	//given
+	dir, _ := ioutil.TempDir("", "watcher")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "naming.yaml")
+	writeConfiguration(t, file, "a: []\n")
+	changes := make(chan bool, 1)
+	watcher := NewFileWatcher(file, 10*time.Millisecond, func() { changes <- true })
+	go watcher.poll(modificationTime(file))
+	defer watcher.Close()
+
+	//when
+	_ = os.Chtimes(file, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+
+	//then
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Errorf("poll(): change was not detected")
+	}
+}
+
+func Test_FileWatcher_watch_coalescesEvents(t *testing.T) {
+	//given
+	dir, _ := ioutil.TempDir("", "watcher")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "naming.yaml")
+	writeConfiguration(t, file, "a: []\n")
+	changes := make(chan bool, 10)
+	watcher := NewFileWatcher(file, time.Second, func() { changes <- true })
+	watcher.quietPeriod = 100 * time.Millisecond
+	notify, err := fsnotify.NewWatcher()
+	if err != nil || notify.Add(dir) != nil {
+		t.Skipf("inotify is not available: %v", err)
+	}
+	go watcher.watch(notify)
+	defer watcher.Close()
+
+	//when
+	for i := 0; i < 5; i++ {
+		writeConfiguration(t, file, "a: []\n")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	//then
+	select {
+	case <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("watch(): change was not detected")
+	}
+	select {
+	case <-changes:
+		t.Errorf("watch(): burst of writes reloaded more than once")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func Test_FileWatcher_isRelevant(t *testing.T) {
+	//given
+	watcher := NewFileWatcher("/etc/mqtt_exporter/naming.yaml", time.Second, func() {})
+	tests := []struct {
+		event fsnotify.Event
+		want  bool
+	}{
+		{fsnotify.Event{Name: "/etc/mqtt_exporter/naming.yaml", Op: fsnotify.Write}, true},
+		{fsnotify.Event{Name: "/etc/mqtt_exporter/naming.yaml", Op: fsnotify.Chmod}, false},
+		{fsnotify.Event{Name: "/etc/mqtt_exporter/..data", Op: fsnotify.Create}, true},
+		{fsnotify.Event{Name: "/etc/mqtt_exporter/other.yaml", Op: fsnotify.Write}, false},
+	}
+
+	for _, tt := range tests {
+		//when
+		result := watcher.isRelevant(tt.event)
+
+		//then
+		if result != tt.want {
+			t.Errorf("isRelevant(%s) = %t, want %t", tt.event, result, tt.want)
+		}
+	}
+}
+
+func Test_FileWatcher_isRelevant_directoryAndGlob(t *testing.T) {
+	//given
+	dir, _ := ioutil.TempDir("", "watcher")
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		source string
+		event  fsnotify.Event
+		want   bool
+	}{
+		{dir, fsnotify.Event{Name: filepath.Join(dir, "team.yaml"), Op: fsnotify.Create}, true},
+		{dir, fsnotify.Event{Name: filepath.Join(dir, "team.yml"), Op: fsnotify.Remove}, true},
+		{dir, fsnotify.Event{Name: filepath.Join(dir, ".team.yaml.swp"), Op: fsnotify.Write}, false},
+		{filepath.Join(dir, "team_*.yaml"), fsnotify.Event{Name: filepath.Join(dir, "team_a.yaml"), Op: fsnotify.Write}, true},
+		{filepath.Join(dir, "team_*.yaml"), fsnotify.Event{Name: filepath.Join(dir, "other.yaml"), Op: fsnotify.Write}, false},
+	}
+
+	for _, tt := range tests {
+		watcher := NewFileWatcher(tt.source, time.Second, func() {})
+
+		//when
+		result := watcher.isRelevant(tt.event)
+
+		//then
+		if result != tt.want {
+			t.Errorf("isRelevant(%s) = %t, want %t", tt.event, result, tt.want)
+		}
+	}
+}
+
+func Test_modificationTime_directory(t *testing.T) {
+	//given
+	dir, _ := ioutil.TempDir("", "watcher")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "naming.yaml")
+	writeConfiguration(t, file, "a: []\n")
+	modified := time.Now().Add(time.Hour).Truncate(time.Second)
+	_ = os.Chtimes(file, modified, modified)
+
+	//when
+	result := modificationTime(dir)
+
+	//then
+	if !result.Equal(modified) {
+		t.Errorf("modificationTime() = %v, want %v", result, modified)
+	}
+}
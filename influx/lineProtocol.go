@@ -0,0 +1,52 @@
+package influx
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/klaper_/mqtt_data_exporter/backend"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+)
+
+// line formats sample as `<metric name>,<labels as tags> value=<value> <timestamp in ns>`; device properties are tags as well,
+// also when they are exported in device_info only (series labels win).
+// Tags with empty values are skipped and samples which are not finite are rejected, as InfluxDB does not accept them
+func line(sample backend.Sample) (string, bool) {
+	if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+		return "", false
+	}
+	tags := make(map[string]string, len(sample.Properties)+len(sample.Labels))
+	for name, value := range sample.Properties {
+		tags[name] = value
+	}
+	for name, value := range sample.Labels {
+		tags[name] = value
+	}
+	names := make([]string, 0, len(tags))
+	for name, value := range tags {
+		if value != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	builder.WriteString(measurementEscaper.Replace(sample.Name))
+	for _, name := range names {
+		builder.WriteByte(',')
+		builder.WriteString(tagEscaper.Replace(name))
+		builder.WriteByte('=')
+		builder.WriteString(tagEscaper.Replace(tags[name]))
+	}
+	builder.WriteString(" value=")
+	builder.WriteString(strconv.FormatFloat(sample.Value, 'f', -1, 64))
+	builder.WriteByte(' ')
+	builder.WriteString(strconv.FormatInt(sample.Timestamp.UnixNano(), 10))
+	return builder.String(), true
+}
@@ -0,0 +1,63 @@
+package influx
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/klaper_/mqtt_data_exporter/backend"
+)
+
+func Test_line(t *testing.T) {
+	timestamp := time.Unix(1600000000, 5)
+	tests := []struct {
+		name   string
+		sample backend.Sample
+		want   string
+		wantOk bool
+	}{
+		{
+			name:   "gauge",
+			sample: backend.Sample{Name: "mqtt_exporter_temperature", Kind: backend.Gauge, Labels: map[string]string{"device": "sonoff", "group": "living room"}, Value: 21.5, Timestamp: timestamp},
+			want:   `mqtt_exporter_temperature,device=sonoff,group=living\ room value=21.5 1600000000000000005`, wantOk: true,
+		},
+		{
+			name:   "tags are sorted and empty ones skipped",
+			sample: backend.Sample{Name: "power", Labels: map[string]string{"group": "", "friendly_name": "Lamp", "device": "sonoff"}, Value: 3, Timestamp: timestamp},
+			want:   `power,device=sonoff,friendly_name=Lamp value=3 1600000000000000005`, wantOk: true,
+		},
+		{
+			name:   "device properties of device info mode are tags",
+			sample: backend.Sample{Name: "power", Labels: map[string]string{"device": "sonoff"}, Properties: map[string]string{"device": "sonoff", "friendly_name": "Lamp", "group": "hall", "floor": ""}, Value: 3, Timestamp: timestamp},
+			want:   `power,device=sonoff,friendly_name=Lamp,group=hall value=3 1600000000000000005`, wantOk: true,
+		},
+		{
+			name:   "series labels win over device properties",
+			sample: backend.Sample{Name: "power", Labels: map[string]string{"device": "sonoff", "group": "kitchen"}, Properties: map[string]string{"device": "sonoff", "group": "hall"}, Value: 3, Timestamp: timestamp},
+			want:   `power,device=sonoff,group=kitchen value=3 1600000000000000005`, wantOk: true,
+		},
+		{
+			name:   "special characters are escaped",
+			sample: backend.Sample{Name: "my metric,1", Labels: map[string]string{"ssid": "a=b,c d"}, Value: 1000000, Timestamp: timestamp},
+			want:   `my\ metric\,1,ssid=a\=b\,c\ d value=1000000 1600000000000000005`, wantOk: true,
+		},
+		{
+			name:   "NaN is rejected",
+			sample: backend.Sample{Name: "power", Value: math.NaN(), Timestamp: timestamp},
+			wantOk: false,
+		},
+		{
+			name:   "infinity is rejected",
+			sample: backend.Sample{Name: "power", Value: math.Inf(1), Timestamp: timestamp},
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := line(tt.sample)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("line() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
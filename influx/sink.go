@@ -0,0 +1,217 @@
+package influx
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klaper_/mqtt_data_exporter/backend"
+	"github.com/klaper_/mqtt_data_exporter/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const moduleId = "influx"
+
+const LinesCount = "influx_lines_total"
+
+// udpPayloadSize keeps datagrams below common MTU; lines are never split between datagrams
+const udpPayloadSize = 1400
+
+type Config struct {
+	// URL is HTTP write endpoint (e.g. http://influxdb:8086/api/v2/write?org=home&bucket=mqtt or http://influxdb:8086/write?db=mqtt)
+	// or udp://host:port of UDP listener (e.g. telegraf socket_listener)
+	URL string
+	// Token is sent as "Authorization: Token <token>" header of HTTP writes
+	Token         string
+	BatchSize     int
+	FlushInterval time.Duration
+	Timeout       time.Duration
+}
+
+// writer sends batch of lines
+type writer interface {
+	write(lines []string) error
+}
+
+// Sink batches samples as InfluxDB line protocol; batch is sent when it is full or every flush interval.
+// Batches which could not be sent are dropped, and lines exceeding few batches waiting for flush are dropped too.
+type Sink struct {
+	config Config
+	writer writer
+
+	lock  sync.Mutex
+	lines []string
+	flush chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+
+	linesCounter *prometheus.CounterVec
+}
+
+func NewSink(config Config, registerer prometheus.Registerer, metricsPrefix string) (*Sink, error) {
+	if config.FlushInterval <= 0 {
+		return nil, fmt.Errorf("InfluxDB flush interval has to be positive, got %v", config.FlushInterval)
+	}
+	address, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	var sinkWriter writer
+	switch address.Scheme {
+	case "http", "https":
+		sinkWriter = &httpWriter{url: config.URL, token: config.Token, client: &http.Client{Timeout: config.Timeout}}
+	case "udp":
+		connection, err := net.Dial("udp", address.Host)
+		if err != nil {
+			return nil, err
+		}
+		sinkWriter = &udpWriter{connection: connection}
+	default:
+		return nil, fmt.Errorf("unsupported InfluxDB URL scheme %q, expected http, https or udp", address.Scheme)
+	}
+	if config.BatchSize < 1 {
+		config.BatchSize = 1
+	}
+	sink := &Sink{
+		config: config,
+		writer: sinkWriter,
+		flush:  make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		linesCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: metricsPrefix + "_" + LinesCount,
+				Help: "Count of InfluxDB lines by result: sent, failed or dropped (too many lines waiting)",
+			}, []string{"result"}),
+	}
+	if err := registerer.Register(sink.linesCounter); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (sink *Sink) Write(sample backend.Sample) {
+	encoded, ok := line(sample)
+	if !ok {
+		logger.Debug(moduleId, "Skipping %v value of %s", sample.Value, sample.Name)
+		return
+	}
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	if len(sink.lines) >= 10*sink.config.BatchSize {
+		sink.linesCounter.WithLabelValues("dropped").Inc()
+		return
+	}
+	sink.lines = append(sink.lines, encoded)
+	if len(sink.lines) >= sink.config.BatchSize {
+		select {
+		case sink.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run sends batches in background until Stop is called
+func (sink *Sink) Run() {
+	ticker := time.NewTicker(sink.config.FlushInterval)
+	go func() {
+		defer close(sink.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sink.stop:
+				sink.Flush()
+				return
+			case <-ticker.C:
+			case <-sink.flush:
+			}
+			sink.Flush()
+		}
+	}()
+}
+
+// Stop stops background sending of running sink; it returns after remaining lines are sent
+func (sink *Sink) Stop() {
+	close(sink.stop)
+	<-sink.done
+}
+
+// Flush sends all waiting lines in batches of BatchSize
+func (sink *Sink) Flush() {
+	sink.lock.Lock()
+	lines := sink.lines
+	sink.lines = nil
+	sink.lock.Unlock()
+
+	for len(lines) > 0 {
+		size := sink.config.BatchSize
+		if size > len(lines) {
+			size = len(lines)
+		}
+		if err := sink.writer.write(lines[:size]); err != nil {
+			logger.Warn(moduleId, "Could not write %d lines to %s: %v", size, sink.config.URL, err)
+			sink.linesCounter.WithLabelValues("failed").Add(float64(size))
+		} else {
+			sink.linesCounter.WithLabelValues("sent").Add(float64(size))
+		}
+		lines = lines[size:]
+	}
+}
+
+type httpWriter struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (writer *httpWriter) write(lines []string) error {
+	request, err := http.NewRequest(http.MethodPost, writer.url, strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if writer.token != "" {
+		request.Header.Set("Authorization", "Token "+writer.token)
+	}
+	response, err := writer.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return nil
+}
+
+type udpWriter struct {
+	connection net.Conn
+}
+
+// write packs lines into datagrams of up to udpPayloadSize bytes (longer lines are sent alone)
+func (writer *udpWriter) write(lines []string) error {
+	var datagram bytes.Buffer
+	send := func() error {
+		if datagram.Len() == 0 {
+			return nil
+		}
+		_, err := writer.connection.Write(datagram.Bytes())
+		datagram.Reset()
+		return err
+	}
+	for _, line := range lines {
+		if datagram.Len() > 0 && datagram.Len()+len(line)+1 > udpPayloadSize {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+		datagram.WriteString(line)
+		datagram.WriteByte('\n')
+	}
+	return send()
+}
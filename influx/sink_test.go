@@ -0,0 +1,190 @@
+package influx
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klaper_/mqtt_data_exporter/backend"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type testReceiver struct {
+	lock    sync.Mutex
+	status  int
+	bodies  []string
+	headers []http.Header
+}
+
+func (receiver *testReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	receiver.bodies = append(receiver.bodies, string(body))
+	receiver.headers = append(receiver.headers, r.Header)
+	if receiver.status != 0 {
+		w.WriteHeader(receiver.status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (receiver *testReceiver) received() []string {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	return append([]string{}, receiver.bodies...)
+}
+
+func testSample(value float64) backend.Sample {
+	return backend.Sample{Name: "temperature", Kind: backend.Gauge, Labels: map[string]string{"device": "sonoff"}, Value: value, Timestamp: time.Unix(1, 0)}
+}
+
+func TestSink_Flush(t *testing.T) {
+	tests := []struct {
+		name        string
+		batchSize   int
+		status      int
+		samples     int
+		wantBodies  []string
+		wantResults map[string]float64
+	}{
+		{"single batch", 10, 0, 2, []string{"temperature,device=sonoff value=0 1000000000\ntemperature,device=sonoff value=1 1000000000"}, map[string]float64{"sent": 2}},
+		{"split into batches", 2, 0, 3, []string{"temperature,device=sonoff value=0 1000000000\ntemperature,device=sonoff value=1 1000000000", "temperature,device=sonoff value=2 1000000000"}, map[string]float64{"sent": 3}},
+		{"failed batch is dropped", 10, http.StatusBadRequest, 2, []string{"temperature,device=sonoff value=0 1000000000\ntemperature,device=sonoff value=1 1000000000"}, map[string]float64{"failed": 2}},
+		{"lines over ten batches are dropped", 1, 0, 12, nil, map[string]float64{"sent": 10, "dropped": 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//given
+			receiver := &testReceiver{status: tt.status}
+			server := httptest.NewServer(receiver)
+			defer server.Close()
+			sink, err := NewSink(Config{URL: server.URL + "/api/v2/write?bucket=test", Token: "secret", BatchSize: tt.batchSize, FlushInterval: time.Minute, Timeout: time.Second}, prometheus.NewRegistry(), "test")
+			if err != nil {
+				t.Fatalf("NewSink() error = %v", err)
+			}
+			for i := 0; i < tt.samples; i++ {
+				sink.Write(testSample(float64(i)))
+			}
+
+			//when
+			sink.Flush()
+
+			//then
+			bodies := receiver.received()
+			if tt.wantBodies != nil && strings.Join(bodies, "|") != strings.Join(tt.wantBodies, "|") {
+				t.Errorf("Flush() sent %q, want %q", bodies, tt.wantBodies)
+			}
+			for _, header := range receiver.headers {
+				if header.Get("Authorization") != "Token secret" {
+					t.Errorf("Flush() sent Authorization %q, want token", header.Get("Authorization"))
+				}
+			}
+			for result, want := range tt.wantResults {
+				if got := testutil.ToFloat64(sink.linesCounter.WithLabelValues(result)); got != want {
+					t.Errorf("Flush() => %s lines = %v, want %v", result, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSink_Run(t *testing.T) {
+	//given
+	receiver := &testReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	sink, _ := NewSink(Config{URL: server.URL, BatchSize: 2, FlushInterval: time.Hour, Timeout: time.Second}, prometheus.NewRegistry(), "test")
+	sink.Run()
+	defer sink.Stop()
+
+	//when
+	sink.Write(testSample(1))
+	sink.Write(testSample(2))
+
+	//then
+	deadline := time.Now().Add(5 * time.Second)
+	for len(receiver.received()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Run() => full batch was not sent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSink_Stop(t *testing.T) {
+	//given
+	receiver := &testReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	sink, _ := NewSink(Config{URL: server.URL, BatchSize: 10, FlushInterval: time.Hour, Timeout: time.Second}, prometheus.NewRegistry(), "test")
+	sink.Run()
+	sink.Write(testSample(1))
+
+	//when
+	sink.Stop()
+
+	//then
+	if bodies := receiver.received(); len(bodies) != 1 || bodies[0] != "temperature,device=sonoff value=1 1000000000" {
+		t.Errorf("Stop() => received %q, want remaining line sent before return", bodies)
+	}
+}
+
+func TestSink_udp(t *testing.T) {
+	//given
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("UDP not available: %v", err)
+	}
+	defer listener.Close()
+	sink, err := NewSink(Config{URL: "udp://" + listener.LocalAddr().String(), BatchSize: 100, FlushInterval: time.Minute}, prometheus.NewRegistry(), "test")
+	if err != nil {
+		t.Fatalf("NewSink() error = %v", err)
+	}
+	samples := 50
+	for i := 0; i < samples; i++ {
+		sink.Write(testSample(float64(i)))
+	}
+
+	//when
+	sink.Flush()
+
+	//then
+	received := 0
+	buffer := make([]byte, 65536)
+	for received < samples {
+		listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := listener.ReadFrom(buffer)
+		if err != nil {
+			t.Fatalf("received %d lines, want %d: %v", received, samples, err)
+		}
+		if n > udpPayloadSize {
+			t.Errorf("datagram of %d bytes exceeds %d", n, udpPayloadSize)
+		}
+		received += strings.Count(string(buffer[:n]), "\n")
+	}
+}
+
+func TestNewSink_invalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"unsupported scheme", Config{URL: "tcp://localhost:8094", FlushInterval: time.Minute}},
+		{"zero flush interval", Config{URL: "http://localhost:8086/write?db=mqtt"}},
+		{"negative flush interval", Config{URL: "http://localhost:8086/write?db=mqtt", FlushInterval: -time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSink(tt.config, prometheus.NewRegistry(), "test"); err == nil {
+				t.Errorf("NewSink() expected error of invalid config %+v", tt.config)
+			}
+		})
+	}
+}
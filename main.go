@@ -1,30 +1,43 @@
 package main
 
 import (
+	"fmt"
 	"github.com/klaper_/mqtt_data_exporter/devices"
+	"github.com/klaper_/mqtt_data_exporter/influx"
 	"github.com/klaper_/mqtt_data_exporter/logger"
 	exporterMessage "github.com/klaper_/mqtt_data_exporter/message"
 	"github.com/klaper_/mqtt_data_exporter/prom"
+	"github.com/klaper_/mqtt_data_exporter/push"
+	"github.com/klaper_/mqtt_data_exporter/republish"
 	"github.com/klaper_/mqtt_data_exporter/tasmota"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
 	"github.com/dustin/go-broadcast"
 	MQTT "github.com/eclipse/paho.mqtt.golang"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 const moduleId = "main"
 
 var (
-	metricsStore *prom.Metrics
+	metricsStore      *prom.Metrics
+	namingProvider    *devices.PropertiesProvider
+	inventoryProvider *devices.InventoryProperties
+	autoNaming        *devices.AutoProperties
+	reloader          *namingReloader
+	republisher       *republish.Sink
 )
 
-func prometheusListenAndServer(listenAddress *string, metricsPath *string) {
-	http.Handle(*metricsPath, promhttp.Handler())
+func prometheusListenAndServer(listenAddress *string, metricsPath *string, openMetrics *bool, enableLifecycle *bool) {
+	http.Handle(*metricsPath, metricsStore.Handler(*openMetrics))
+	if *enableLifecycle {
+		http.Handle("/-/reload", reloader)
+	}
+	http.Handle("/devices", metricsStore.DevicesHandler())
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Location", *metricsPath)
 		w.WriteHeader(http.StatusMovedPermanently)
@@ -32,7 +45,8 @@ func prometheusListenAndServer(listenAddress *string, metricsPath *string) {
 	log.Panic(http.ListenAndServe(*listenAddress, nil))
 }
 
-func mqttInit(mqttHost *string, mqttClientId *string, mqttUser *string, mqttPassword *string) {
+// mqttInit creates client, which is connected by mqttConnect once everything publishing with it is set up
+func mqttInit(mqttHost *string, mqttClientId *string, mqttUser *string, mqttPassword *string) MQTT.Client {
 	connOpts := MQTT.
 		NewClientOptions().
 		AddBroker(*mqttHost).
@@ -48,7 +62,10 @@ func mqttInit(mqttHost *string, mqttClientId *string, mqttUser *string, mqttPass
 			panic(token.Error())
 		}
 	}
-	client := MQTT.NewClient(connOpts)
+	return MQTT.NewClient(connOpts)
+}
+
+func mqttConnect(client MQTT.Client) {
 	if token := client.Connect(); token.Wait() && token.Error() != nil {
 		panic(token.Error())
 	}
@@ -57,8 +74,12 @@ func mqttInit(mqttHost *string, mqttClientId *string, mqttUser *string, mqttPass
 var broadcaster = broadcast.NewBroadcaster(100)
 
 func onMessageReceived(client MQTT.Client, message MQTT.Message) {
+	if republisher != nil && republisher.Owns(message.Topic()) {
+		return
+	}
 	msg := exporterMessage.NewExporterMessage(message, metricsStore)
 	logger.Debug(moduleId, "Received message on topic: %s", message.Topic())
+	metricsStore.RecordMessage(msg.GetDeviceName())
 	metricsStore.CounterInc(
 		"total_message_count",
 		msg.GetDeviceName(),
@@ -77,6 +98,74 @@ func main() {
 			"web.telemetry-path",
 			"Path under which to expose metrics.",
 		).Default("/metrics").String()
+		webEnableLifecycle = kingpin.Flag(
+			"web.enable-lifecycle",
+			"Enable reloading naming configuration via HTTP request to /-/reload",
+		).Default("false").Bool()
+		webOpenMetrics = kingpin.Flag(
+			"web.openMetrics",
+			"Serve OpenMetrics format (with _created samples, units and exemplars) to scrapers which negotiate it",
+		).Default("false").Bool()
+		pushURL = kingpin.Flag(
+			"push.url",
+			"Pushgateway or remote-write URL metrics are pushed to (empty = disabled)",
+		).Default().String()
+		pushProtocol = kingpin.Flag(
+			"push.protocol",
+			"Push protocol: pushgateway or remote-write",
+		).Default(string(push.Pushgateway)).Enum(string(push.Pushgateway), string(push.RemoteWrite))
+		pushJob = kingpin.Flag(
+			"push.job",
+			"Pushgateway job, or job label of remote-write series",
+		).Default("mqtt_exporter").String()
+		pushInterval = kingpin.Flag(
+			"push.interval",
+			"Interval of pushing metrics",
+		).Default("30s").Duration()
+		pushTimeout = kingpin.Flag(
+			"push.timeout",
+			"Timeout of single push",
+		).Default("10s").Duration()
+		pushBufferSize = kingpin.Flag(
+			"push.bufferSize",
+			"Number of remote-write batches kept while push.url is unavailable",
+		).Default("100").Int()
+		pushMaxBackoff = kingpin.Flag(
+			"push.maxBackoff",
+			"Maximum delay between retries of failed push",
+		).Default("1m").Duration()
+		influxURL = kingpin.Flag(
+			"influx.url",
+			"InfluxDB HTTP write URL (e.g. http://influxdb:8086/api/v2/write?org=home&bucket=mqtt) or udp://host:port metrics are also written to (empty = disabled)",
+		).Default().String()
+		influxToken = kingpin.Flag(
+			"influx.token",
+			"InfluxDB API token",
+		).Default().String()
+		influxBatchSize = kingpin.Flag(
+			"influx.batchSize",
+			"Number of lines sent to InfluxDB at once",
+		).Default("1000").Int()
+		influxFlushInterval = kingpin.Flag(
+			"influx.flushInterval",
+			"Interval of sending lines to InfluxDB when batch is not full",
+		).Default("10s").Duration()
+		influxTimeout = kingpin.Flag(
+			"influx.timeout",
+			"Timeout of single InfluxDB write",
+		).Default("10s").Duration()
+		republishTopic = kingpin.Flag(
+			"republish.topic",
+			"Topic template gauge updates are republished to as JSON, e.g. exporter/<group>/<friendly_name>/<metric> (empty = disabled)",
+		).Default().String()
+		republishQoS = kingpin.Flag(
+			"republish.qos",
+			"QoS of republished messages",
+		).Default("0").Uint8()
+		republishRetain = kingpin.Flag(
+			"republish.retain",
+			"Publish republished messages with retain flag",
+		).Default("false").Bool()
 		mqttHost = kingpin.Flag(
 			"mqtt.host",
 			"Mqtt host address and port.",
@@ -95,7 +184,7 @@ func main() {
 		).Default().String()
 		namingFile = kingpin.Flag(
 			"naming.config",
-			"File containg naming convertions",
+			"File containg naming convertions, or directory/glob of such files",
 		).Default("/etc/mqtt_exporter/naming.yaml").String()
 		metricsPrefix = kingpin.Flag(
 			"metrics.prefix",
@@ -109,6 +198,90 @@ func main() {
 			"cleaner.gauge.timeout",
 			"Timeout for gauge value cleaner (0 = disabled)",
 		).Default("0s").Duration()
+		metricsCleanerCounters = kingpin.Flag(
+			"cleaner.counters",
+			"Remove also counters of devices which were not updated for cleaner.gauge.timeout",
+		).Default("false").Bool()
+		namingCheck = kingpin.Flag(
+			"naming.check",
+			"Validate naming configuration file and exit",
+		).Default("false").Bool()
+		namingWatch = kingpin.Flag(
+			"naming.watch",
+			"Reload naming configuration when file changes",
+		).Default("false").Bool()
+		namingPollInterval = kingpin.Flag(
+			"naming.watch.pollInterval",
+			"Interval of checking naming configuration file when inotify is not available",
+		).Default("30s").Duration()
+		namingAuto = kingpin.Flag(
+			"naming.auto",
+			"Name devices missing in naming configuration after DeviceName/FriendlyName reported by tasmota",
+		).Default("false").Bool()
+		namingInventory = kingpin.Flag(
+			"naming.inventory",
+			"JSON (*.json) or CSV (*.csv) inventory of devices used when device is missing in naming configuration",
+		).Default().String()
+		namingInventoryURL = kingpin.Flag(
+			"naming.inventory.url",
+			"URL of JSON or CSV inventory of devices used when device is missing in naming configuration and inventory file",
+		).Default().String()
+		namingInventoryTTL = kingpin.Flag(
+			"naming.inventory.ttl",
+			"How long inventory fetched from naming.inventory.url is cached",
+		).Default("5m").Duration()
+		namingInventoryTimeout = kingpin.Flag(
+			"naming.inventory.timeout",
+			"Timeout of fetching inventory from naming.inventory.url",
+		).Default("10s").Duration()
+		metricsDeviceTimestamps = kingpin.Flag(
+			"metrics.deviceTimestamps",
+			"Expose samples with timestamps reported by devices instead of scrape time",
+		).Default("false").Bool()
+		metricsDropUnknownDevices = kingpin.Flag(
+			"metrics.dropUnknownDevices",
+			"Drop metrics of devices missing in naming configuration (they are still counted in unknown_device_messages_total)",
+		).Default("false").Bool()
+		metricsDeviceInfo = kingpin.Flag(
+			"metrics.deviceInfo",
+			"Export device properties only in device_info metric and keep only device label on other metrics",
+		).Default("false").Bool()
+		metricsSeriesLimit = kingpin.Flag(
+			"metrics.seriesLimit",
+			"Maximum number of series of all metrics (0 = unlimited)",
+		).Default("0").Int()
+		metricsSeriesLimitPerMetric = kingpin.Flag(
+			"metrics.seriesLimitPerMetric",
+			"Maximum number of series of single metric (0 = unlimited)",
+		).Default("0").Int()
+		metricsSeriesLimitMetric = kingpin.Flag(
+			"metrics.seriesLimit.metric",
+			"Maximum number of series of metric with given key, overrides metrics.seriesLimitPerMetric (repeatable key=limit)",
+		).StringMap()
+		metricsSeriesLimitAction = kingpin.Flag(
+			"metrics.seriesLimitAction",
+			"What to do with new series over the limit: drop them or aggregate them into series with all labels set to \"other\"",
+		).Default(string(prom.DropSeries)).Enum(string(prom.DropSeries), string(prom.AggregateSeries))
+		metricsExemplars = kingpin.Flag(
+			"metrics.exemplars",
+			"Attach MQTT topic and message id exemplars to message_count counter (exposed with web.openMetrics only)",
+		).Default("false").Bool()
+		metricsStrict = kingpin.Flag(
+			"metrics.strict",
+			"Fail startup when any metric could not be registered",
+		).Default("false").Bool()
+		retainedMaxAge = kingpin.Flag(
+			"mqtt.retainedMaxAge",
+			"Skip retained messages with device time older than this (0 = disabled)",
+		).Default("0s").Duration()
+		tasmotaResultCodes = kingpin.Flag(
+			"tasmota.result.code",
+			"RF/IR code exported as label value, other codes are reported as \"other\" (repeatable, \"*\" = all codes)",
+		).Strings()
+		tasmotaUnits = kingpin.Flag(
+			"tasmota.unit",
+			"Unit of tasmota sensor readout, appended to its metric name (repeatable readout=unit, e.g. Temperature=celsius)",
+		).StringMap()
 	)
 
 	kingpin.HelpFlag.Short('h')
@@ -120,17 +293,143 @@ func main() {
 	}
 	logger.SetLogLevel(logger.Loglevel(toSet))
 
-	prepareMetricsStore(metricsPrefix, namingFile, metricsCleanerTimeout)
+	if *namingCheck {
+		if err := devices.CheckConfiguration(*namingFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s: OK\n", *namingFile)
+		os.Exit(0)
+	}
+
+	provider := prepareNamingProviders(namingFile, namingInventory, namingInventoryURL, namingInventoryTTL, namingInventoryTimeout, namingAuto)
+	seriesLimits := prepareSeriesLimits(metricsSeriesLimit, metricsSeriesLimitPerMetric, metricsSeriesLimitMetric, metricsSeriesLimitAction)
+	prepareMetricsStore(metricsPrefix, provider, metricsCleanerTimeout, prom.Options{
+		DeviceTimestamps:   *metricsDeviceTimestamps,
+		DropUnknownDevices: *metricsDropUnknownDevices,
+		DeviceInfo:         *metricsDeviceInfo,
+		CleanCounters:      *metricsCleanerCounters,
+		SeriesLimits:       seriesLimits,
+		Exemplars:          *metricsExemplars,
+	})
 
-	var tasmotaCollector = tasmota.NewTasmotaCollector(metricsStore)
+	if *influxURL != "" {
+		startInfluxSink(influx.Config{URL: *influxURL, Token: *influxToken, BatchSize: *influxBatchSize, FlushInterval: *influxFlushInterval, Timeout: *influxTimeout}, metricsPrefix)
+	}
+
+	reloadables := []reloadableProvider{namingProvider}
+	if inventoryProvider != nil {
+		reloadables = append(reloadables, inventoryProvider)
+	}
+	reloader = newNamingReloader(*metricsPrefix, metricsStore.Registerer(), reloadables...)
+	reloader.handleSignals()
+	if *namingWatch {
+		reloader.watch(*namingFile, *namingPollInterval)
+		if inventoryProvider != nil {
+			reloader.watch(*namingInventory, *namingPollInterval)
+		}
+	}
+
+	var tasmotaCollector = tasmota.NewTasmotaCollector(metricsStore, *tasmotaResultCodes, *tasmotaUnits, *retainedMaxAge, autoNaming)
 	tasmotaCollector.InitializeMessageReceiver(broadcaster)
+	if errs := metricsStore.RegistrationErrors(); len(errs) > 0 && *metricsStrict {
+		logger.Fatal(moduleId, "%d metrics could not be registered: %v", len(errs), errs)
+		os.Exit(1)
+	}
 
-	mqttInit(mqttHost, mqttClientId, mqttUsername, mqttPassword)
-	prometheusListenAndServer(listenAddress, metricsPath)
+	if *pushURL != "" {
+		startPusher(push.Config{URL: *pushURL, Protocol: push.Protocol(*pushProtocol), Job: *pushJob, Interval: *pushInterval, Timeout: *pushTimeout, BufferSize: *pushBufferSize, MinBackoff: time.Second, MaxBackoff: *pushMaxBackoff}, metricsPrefix)
+	}
+
+	mqttClient := mqttInit(mqttHost, mqttClientId, mqttUsername, mqttPassword)
+	if *republishTopic != "" {
+		startRepublisher(republish.Config{Topic: *republishTopic, QoS: *republishQoS, Retain: *republishRetain}, mqttClient, metricsPrefix)
+	}
+	mqttConnect(mqttClient)
+	prometheusListenAndServer(listenAddress, metricsPath, webOpenMetrics, webEnableLifecycle)
+}
+
+// prepareNamingProviders layers naming sources: naming configuration, inventory file, inventory URL and names learned from devices;
+// the first one which knows the device wins
+func prepareNamingProviders(namingConfiguration *string, inventoryFile *string, inventoryURL *string, inventoryTTL *time.Duration, inventoryTimeout *time.Duration, namingAuto *bool) prom.DevicePropertiesProvider {
+	var err error
+	namingProvider, err = devices.NewProperties(*namingConfiguration)
+	if err != nil {
+		logger.Fatal(moduleId, "Invalid naming configuration:\n%v", err)
+		os.Exit(1)
+	}
+	providers := []devices.PropertiesSource{namingProvider}
+	if *inventoryFile != "" {
+		inventoryProvider, err = devices.NewInventoryProperties(*inventoryFile, namingProvider.GetDefaultLabels())
+		if err != nil {
+			logger.Fatal(moduleId, "Invalid inventory:\n%v", err)
+			os.Exit(1)
+		}
+		providers = append(providers, inventoryProvider)
+	}
+	if *inventoryURL != "" {
+		providers = append(providers, devices.NewHTTPProperties(*inventoryURL, *inventoryTTL, *inventoryTimeout, namingProvider.GetDefaultLabels(), func(changed []string) {
+			metricsStore.RetireDevices(changed)
+		}))
+	}
+	if *namingAuto {
+		autoNaming = devices.NewAutoProperties()
+		providers = append(providers, autoNaming)
+	}
+	if len(providers) == 1 {
+		return namingProvider
+	}
+	return devices.NewLayeredProperties(providers...)
+}
+
+// startPusher pushes metrics store beside serving it, for exporters which can not be scraped (e.g. behind NAT)
+func startPusher(config push.Config, metricsPrefix *string) {
+	pusher, err := push.NewPusher(config, metricsStore.Gatherer(), metricsStore.Registerer(), *metricsPrefix)
+	if err != nil {
+		logger.Fatal(moduleId, "Could not start pushing metrics: %v", err)
+		os.Exit(1)
+	}
+	pusher.Run()
+}
+
+// startInfluxSink writes every gauge and counter update also to InfluxDB
+func startInfluxSink(config influx.Config, metricsPrefix *string) {
+	sink, err := influx.NewSink(config, metricsStore.Registerer(), *metricsPrefix)
+	if err != nil {
+		logger.Fatal(moduleId, "Could not start InfluxDB sink: %v", err)
+		os.Exit(1)
+	}
+	metricsStore.AddSink(sink)
+	sink.Run()
+}
+
+// startRepublisher publishes every gauge update with the client exporter subscribes with
+func startRepublisher(config republish.Config, client MQTT.Client, metricsPrefix *string) {
+	var err error
+	republisher, err = republish.NewSink(config, client, metricsStore.Registerer(), *metricsPrefix)
+	if err != nil {
+		logger.Fatal(moduleId, "Could not start republishing: %v", err)
+		os.Exit(1)
+	}
+	metricsStore.AddSink(republisher)
+	republisher.Run()
+}
+
+func prepareSeriesLimits(global *int, perMetric *int, metricLimits *map[string]string, action *string) prom.SeriesLimits {
+	limits := prom.SeriesLimits{Global: *global, PerMetric: *perMetric, Metrics: make(map[string]int), Action: prom.SeriesLimitAction(*action)}
+	for key, value := range *metricLimits {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			logger.Fatal(moduleId, "Invalid series limit %q of metric %s", value, key)
+			os.Exit(1)
+		}
+		limits.Metrics[key] = limit
+	}
+	return limits
 }
 
-func prepareMetricsStore(metricsPrefix *string, namingConfiguration *string, metricsCleanerTimeout *time.Duration) {
-	metricsStore = prom.NewMetrics(*metricsPrefix, devices.NewProperties(*namingConfiguration), *metricsCleanerTimeout)
+func prepareMetricsStore(metricsPrefix *string, provider prom.DevicePropertiesProvider, metricsCleanerTimeout *time.Duration, options prom.Options) {
+	metricsStore = prom.NewMetrics(*metricsPrefix, provider, *metricsCleanerTimeout, options)
 	metricsStore.RegisterCounter(
 		"total_message_count",
 		"total_message_count",
@@ -1,7 +1,8 @@
 package message
 
 import (
-	"github.com/klaper_/mqtt_data_exporter/prom"
+	"github.com/klaper_/mqtt_data_exporter/backend"
+	"strconv"
 	"strings"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
@@ -12,14 +13,15 @@ type State string
 const (
 	Processed State = "processed"
 	Ignored   State = "ignored"
+	Stale     State = "stale"
 )
 
 type ExporterMessage struct {
 	msg          MQTT.Message
-	metricsStore *prom.Metrics
+	metricsStore backend.Store
 }
 
-func NewExporterMessage(msg MQTT.Message, metricsStore *prom.Metrics) *ExporterMessage {
+func NewExporterMessage(msg MQTT.Message, metricsStore backend.Store) *ExporterMessage {
 	return &ExporterMessage{msg: msg, metricsStore: metricsStore}
 }
 
@@ -28,13 +30,18 @@ func (e *ExporterMessage) GetDeviceName() string {
 }
 
 func (e *ExporterMessage) ProcessMessage(exporterModule string, state State) {
-	e.metricsStore.CounterInc(
+	e.metricsStore.CounterAddWithExemplar(
 		"message_count",
 		e.GetDeviceName(),
 		map[string]string{
 			"processing_state": string(state),
 			"exporter_module":  exporterModule,
 		},
+		1,
+		map[string]string{
+			"topic":      e.msg.Topic(),
+			"message_id": strconv.Itoa(int(e.msg.MessageID())),
+		},
 	)
 }
 
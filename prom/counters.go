@@ -1,35 +1,79 @@
 package prom
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"fmt"
+	"time"
 
-func (metrics *Metrics) RegisterCounter(key string, name string, description string, labelNames []string) bool {
+	"github.com/klaper_/mqtt_data_exporter/backend"
+	"github.com/klaper_/mqtt_data_exporter/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func (metrics *Metrics) RegisterCounter(key string, name string, description string, labelNames []string) error {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
 	_, ok := metrics.counters[key]
 	if ok {
-		return false
+		return metrics.registrationFailed(fmt.Errorf("%w: counter %s", ErrKeyRegistered, key))
 	}
-	labels := prepareLabelNames(labelNames)
-	metrics.counters[key] = counterWithMetadata{
+	labels := metrics.prepareLabelNames(labelNames)
+	counter := counterWithMetadata{
 		metric: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: metrics.prefixName(name),
 				Help: description,
 			}, labels),
 		labels: labels,
+		name:   metrics.prefixName(name),
+	}
+	if err := metrics.register(key, name, labelNames, counter.metric); err != nil {
+		return err
 	}
-	err := prometheus.Register(metrics.counters[key].metric)
-	return err == nil
+	metrics.counters[key] = counter
+	if metrics.cleanCounters {
+		metrics.gaugeCleaner.RegisterGauge(cleanerKey(counterKind, key), metrics.seriesLimiter.tracked(counterKind, key, counter.metric))
+	}
+	return nil
 }
 
 func (metrics *Metrics) CounterInc(key string, deviceName string, labels map[string]string) {
-	counter, found := metrics.counters[key]
-	if !found {
+	metrics.CounterAdd(key, deviceName, labels, 1)
+}
+
+// CounterAdd increases counter by delta (e.g. energy consumed since last report); negative delta is rejected
+func (metrics *Metrics) CounterAdd(key string, deviceName string, labels map[string]string, delta float64) {
+	metrics.CounterAddWithExemplar(key, deviceName, labels, delta, nil)
+}
+
+// CounterAddWithExemplar works as CounterAdd and attaches exemplar (e.g. MQTT topic of the message) when exemplars are enabled
+func (metrics *Metrics) CounterAddWithExemplar(key string, deviceName string, labels map[string]string, delta float64, exemplar map[string]string) {
+	counter, found := metrics.getCounter(key)
+	if !found || metrics.isDropped(deviceName) {
 		return
 	}
-	var completedLabels = metrics.prepareLabelValues(counter.labels, metrics.appendRestrictedToValues(deviceName, labels))
-	counter.metric.WithLabelValues(completedLabels...).Inc()
+	if delta < 0 {
+		logger.Warn("prometheus", "Skipping negative delta %v of %s counter for device %s", delta, key, deviceName)
+		return
+	}
+	completedLabels, ok := metrics.seriesValues(counterKind, key, deviceName, counter.labels, labels)
+	if !ok {
+		return
+	}
+	series := counter.metric.WithLabelValues(completedLabels...)
+	if adder, ok := series.(prometheus.ExemplarAdder); ok && metrics.exemplars && len(exemplar) > 0 {
+		adder.AddWithExemplar(delta, exemplarLabels(exemplar))
+	} else {
+		series.Add(delta)
+	}
+	labelsOfSeries := seriesLabels(counter.labels, completedLabels)
+	if metrics.cleanCounters {
+		metrics.gaugeCleaner.updateMetric(cleanerKey(counterKind, key), labelsOfSeries)
+	}
+	metrics.toSinks(backend.Counter, counter.name, deviceName, labelsOfSeries, series, time.Time{})
 }
 
 type counterWithMetadata struct {
 	metric *prometheus.CounterVec
 	labels []string
+	name   string
 }
@@ -1,10 +1,16 @@
 package prom
 
-import "testing"
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
 
 func TestMetrics_RegisterCounter_Count(t *testing.T) {
 	//given
-	metrics := NewMetrics("", nil, 0)
+	metrics := NewMetrics("", nil, 0, Options{})
 	initialLen := len(metrics.counters)
 
 	//when
@@ -18,7 +24,7 @@ func TestMetrics_RegisterCounter_Count(t *testing.T) {
 
 func TestMetrics_RegisterCounter_Key(t *testing.T) {
 	//given
-	metrics := NewMetrics("", nil, 0)
+	metrics := NewMetrics("", nil, 0, Options{})
 
 	//when
 	metrics.RegisterCounter(firstInputMetricsKey, firstInputMetricsName, inputMetricsDescription, inputLabelNames)
@@ -31,11 +37,11 @@ func TestMetrics_RegisterCounter_Key(t *testing.T) {
 
 func TestMetrics_RegisterCounter_MetricExists(t *testing.T) {
 	//given
-	metrics := NewMetrics("", nil, 0)
+	metrics := NewMetrics("", nil, 0, Options{})
 	metrics.RegisterCounter(firstInputMetricsKey, firstInputMetricsName, inputMetricsDescription, inputLabelNames)
 
 	//when
-	ok := metrics.RegisterCounter(
+	err := metrics.RegisterCounter(
 		firstInputMetricsKey,
 		"TestMetrics_RegisterCounter_MetricExists",
 		inputMetricsDescription,
@@ -43,18 +49,18 @@ func TestMetrics_RegisterCounter_MetricExists(t *testing.T) {
 	)
 
 	//then
-	if ok {
-		t.Errorf("RegisterMetric() = %v, want %v", ok, false)
+	if !errors.Is(err, ErrKeyRegistered) {
+		t.Errorf("RegisterMetric() = %v, want %v", err, ErrKeyRegistered)
 	}
 }
 
 func TestMetrics_RegisterCounter_MetricAdded(t *testing.T) {
 	//given
-	metrics := NewMetrics("", nil, 0)
+	metrics := NewMetrics("", nil, 0, Options{})
 	metrics.RegisterCounter(firstInputMetricsKey, firstInputMetricsName, inputMetricsDescription, inputLabelNames)
 
 	//when
-	ok := metrics.RegisterCounter(
+	err := metrics.RegisterCounter(
 		secondInputMetricsKey,
 		"TestMetrics_RegisterCounter_MetricAdded",
 		inputMetricsDescription,
@@ -62,7 +68,71 @@ func TestMetrics_RegisterCounter_MetricAdded(t *testing.T) {
 	)
 
 	//then
-	if !ok {
-		t.Errorf("RegisterMetric() = %v, want %v", ok, true)
+	if err != nil {
+		t.Errorf("RegisterMetric() = %v, want %v", err, nil)
+	}
+}
+
+func TestMetrics_CounterAdd(t *testing.T) {
+	tests := []struct {
+		name   string
+		deltas []float64
+		want   float64
+	}{
+		{"increments", []float64{1, 1}, 2},
+		{"adds deltas", []float64{0.5, 2.25}, 2.75},
+		{"skips negative delta", []float64{3, -1}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//given
+			metrics := NewMetrics("", TestNamingService{}, 0, Options{})
+			metrics.RegisterCounter(firstInputMetricsKey, firstInputMetricsName, inputMetricsDescription, []string{})
+
+			//when
+			for _, delta := range tt.deltas {
+				metrics.CounterAdd(firstInputMetricsKey, inputDeviceName, map[string]string{}, delta)
+			}
+
+			//then
+			counter := metrics.counters[firstInputMetricsKey].metric.WithLabelValues(expectedDeviceName, expectedDeviceGroup, expectedDeviceFName)
+			if value := testutil.ToFloat64(counter); value != tt.want {
+				t.Errorf("CounterAdd() => value = %v, want %v", value, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetrics_CounterAdd_cleaned(t *testing.T) {
+	tests := []struct {
+		name          string
+		cleanCounters bool
+		want          int
+	}{
+		{"counters kept by default", false, 1},
+		{"counters cleaned when enabled", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//given
+			metrics := NewMetrics("", TestNamingService{}, 0, Options{CleanCounters: tt.cleanCounters})
+			clock := &testClock{current: startDate}
+			metrics.gaugeCleaner.timeout = time.Second
+			metrics.gaugeCleaner.clk = clock
+			metrics.RegisterCounter(firstInputMetricsKey, firstInputMetricsName, inputMetricsDescription, []string{})
+			metrics.RegisterGauge(firstInputMetricsKey, secondInputMetricsName, inputMetricsDescription, []string{})
+			metrics.CounterAdd(firstInputMetricsKey, inputDeviceName, map[string]string{}, 5)
+			metrics.gaugeCleaner.Close()
+			metrics.gaugeCleaner.receive()
+
+			//when
+			clock.MoveForward(2 * time.Second)
+			metrics.gaugeCleaner.clean()
+
+			//then
+			if count := countSeries(metrics.counters[firstInputMetricsKey].metric); count != tt.want {
+				t.Errorf("clean() => counter has %d series, want %d", count, tt.want)
+			}
+		})
 	}
 }
@@ -0,0 +1,76 @@
+package prom
+
+import (
+	"sort"
+
+	"github.com/klaper_/mqtt_data_exporter/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const DeviceInfoName = "device_info"
+
+// DeviceLister is implemented by naming providers which know their devices up front (e.g. naming configuration)
+type DeviceLister interface {
+	ListDevices() []string
+}
+
+// deviceInfoCollector exposes properties of every known device as labels of constant 1 metric, so they can be
+// joined with data metrics in PromQL on "device" label
+type deviceInfoCollector struct {
+	metrics *Metrics
+	desc    *prometheus.Desc
+}
+
+func newDeviceInfoCollector(metrics *Metrics) *deviceInfoCollector {
+	labelNames := append(append([]string{}, restrictedLabelNames...), metrics.customLabelNames...)
+	collector := &deviceInfoCollector{
+		metrics: metrics,
+		desc: prometheus.NewDesc(
+			metrics.prefixName(DeviceInfoName),
+			"Properties of device from naming configuration",
+			labelNames,
+			nil,
+		),
+	}
+	err := metrics.registry.Register(collector)
+	logger.Debug("device_info", "%s register error: %v", DeviceInfoName, err)
+	return collector
+}
+
+func (collector *deviceInfoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.desc
+}
+
+// Collect exposes listed devices and devices messages were received from (e.g. matched by pattern or learned)
+func (collector *deviceInfoCollector) Collect(ch chan<- prometheus.Metric) {
+	names := make(map[string]bool)
+	if lister, ok := collector.metrics.propertiesProvider.(DeviceLister); ok {
+		for _, name := range lister.ListDevices() {
+			names[name] = true
+		}
+	}
+	for name := range collector.metrics.deviceTracker.snapshot() {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		properties, ok := collector.metrics.getProperties(name)
+		if !ok {
+			continue
+		}
+		labelValues := []string{properties.Device, properties.Group, properties.Name}
+		for _, label := range collector.metrics.customLabelNames {
+			value, ok := properties.Labels[label]
+			if !ok {
+				value = collector.metrics.customLabels[label]
+			}
+			labelValues = append(labelValues, value)
+		}
+		ch <- prometheus.MustNewConstMetric(collector.desc, prometheus.GaugeValue, 1, labelValues...)
+	}
+}
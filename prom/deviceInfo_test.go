@@ -0,0 +1,49 @@
+package prom
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type ListingNamingService struct {
+	LabeledNamingService
+}
+
+func (t ListingNamingService) ListDevices() []string {
+	return []string{inputDeviceName, "removedDevice"}
+}
+
+func TestMetrics_deviceInfo_labelNames(t *testing.T) {
+	//given
+	metrics := NewMetrics("", LabeledNamingService{}, 0, Options{DeviceInfo: true})
+
+	//when
+	result := metrics.prepareLabelNames([]string{"sensor_name", "group"})
+
+	//then
+	if expected := []string{"device", "sensor_name", "module_group", "sensor_alias", "sensor_location"}; !reflect.DeepEqual(result, expected) {
+		t.Errorf("prepareLabelNames() = %v, want %v", result, expected)
+	}
+}
+
+func TestMetrics_deviceInfo_collect(t *testing.T) {
+	//given
+	metrics := NewMetrics("test", ListingNamingService{}, 0, Options{DeviceInfo: true})
+	metrics.RecordMessage("unknownDevice")
+	expected := `
+# HELP test_device_info Properties of device from naming configuration
+# TYPE test_device_info gauge
+test_device_info{device="deviceName",floor="ground",friendly_name="deviceFName",group="deviceGroup",room="default_room"} 1
+`
+
+	//when
+	err := testutil.CollectAndCompare(newDeviceInfoCollector(metrics), strings.NewReader(expected))
+
+	//then
+	if err != nil {
+		t.Errorf("device_info: %v", err)
+	}
+}
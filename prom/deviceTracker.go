@@ -0,0 +1,130 @@
+package prom
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/klaper_/mqtt_data_exporter/devices"
+	"github.com/klaper_/mqtt_data_exporter/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const UnknownDeviceMessagesCount = "unknown_device_messages_total"
+
+// maxTrackedDevices is size of tracked devices table; devices seen after it is full are neither listed in /devices
+// nor counted in unknown_device_messages_total
+const maxTrackedDevices = 10000
+
+type seenDevice struct {
+	lastSeen time.Time
+	messages uint64
+}
+
+// deviceTracker remembers devices messages were received from
+type deviceTracker struct {
+	lock           sync.Mutex
+	devices        map[string]*seenDevice
+	maxDevices     int
+	unknownCounter *prometheus.CounterVec
+	now            func() time.Time
+}
+
+type deviceReport struct {
+	Device     string    `json:"device"`
+	Configured bool      `json:"configured"`
+	Name       string    `json:"name,omitempty"`
+	Group      string    `json:"group,omitempty"`
+	LastSeen   time.Time `json:"last_seen"`
+	Messages   uint64    `json:"messages"`
+}
+
+func newDeviceTracker(unknownCounterName string, registerer prometheus.Registerer) *deviceTracker {
+	tracker := &deviceTracker{
+		devices:    make(map[string]*seenDevice),
+		maxDevices: maxTrackedDevices,
+		unknownCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: unknownCounterName,
+				Help: "Count of MQTT messages received from devices missing in naming configuration",
+			}, []string{"device"}),
+		now: time.Now,
+	}
+	err := registerer.Register(tracker.unknownCounter)
+	logger.Debug("device_tracker", "%s register error: %v", unknownCounterName, err)
+	return tracker
+}
+
+// seen records message of device; devices over the limit are neither tracked nor counted as unknown
+func (tracker *deviceTracker) seen(deviceName string, configured bool) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	device, ok := tracker.devices[deviceName]
+	if !ok {
+		if len(tracker.devices) >= tracker.maxDevices {
+			return
+		}
+		device = &seenDevice{}
+		tracker.devices[deviceName] = device
+	}
+	device.lastSeen = tracker.now()
+	device.messages++
+	if !configured {
+		tracker.unknownCounter.WithLabelValues(deviceName).Inc()
+	}
+}
+
+func (tracker *deviceTracker) snapshot() map[string]seenDevice {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	result := make(map[string]seenDevice, len(tracker.devices))
+	for name, device := range tracker.devices {
+		result[name] = *device
+	}
+	return result
+}
+
+// RecordMessage notes message received from device; messages of devices missing in naming configuration are counted separately
+func (metrics *Metrics) RecordMessage(deviceName string) {
+	_, configured := metrics.getProperties(deviceName)
+	metrics.deviceTracker.seen(deviceName, configured)
+}
+
+// isDropped tells whether metrics of device are dropped, as it is missing in naming configuration
+func (metrics *Metrics) isDropped(deviceName string) bool {
+	if !metrics.dropUnknownDevices {
+		return false
+	}
+	_, configured := metrics.getProperties(deviceName)
+	return !configured
+}
+
+func (metrics *Metrics) getProperties(deviceName string) (*devices.Properties, bool) {
+	if metrics.propertiesProvider == nil {
+		return nil, false
+	}
+	return metrics.propertiesProvider.GetProperties(deviceName)
+}
+
+// DevicesHandler serves JSON list of devices messages were received from, with their naming configuration status
+func (metrics *Metrics) DevicesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen := metrics.deviceTracker.snapshot()
+		report := make([]deviceReport, 0, len(seen))
+		for name, device := range seen {
+			entry := deviceReport{Device: name, LastSeen: device.lastSeen, Messages: device.messages}
+			if properties, ok := metrics.getProperties(name); ok {
+				entry.Configured, entry.Name, entry.Group = true, properties.Name, properties.Group
+			}
+			report = append(report, entry)
+		}
+		sort.Slice(report, func(i, j int) bool { return report[i].Device < report[j].Device })
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			logger.Warn("device_tracker", "Could not write devices report: %v", err)
+		}
+	})
+}
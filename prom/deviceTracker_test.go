@@ -0,0 +1,96 @@
+package prom
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics_RecordMessage(t *testing.T) {
+	//given
+	metrics := NewMetrics("", TestNamingService{}, 0, Options{})
+
+	//when
+	metrics.RecordMessage(inputDeviceName)
+	metrics.RecordMessage("unknownDevice")
+	metrics.RecordMessage("unknownDevice")
+
+	//then
+	if value := testutil.ToFloat64(metrics.deviceTracker.unknownCounter.WithLabelValues("unknownDevice")); value != 2 {
+		t.Errorf("RecordMessage() => unknown device messages = %v, want 2", value)
+	}
+	if count := countSeries(metrics.deviceTracker.unknownCounter); count != 1 {
+		t.Errorf("RecordMessage() => configured device should not be counted, got %d series", count)
+	}
+}
+
+func TestMetrics_RecordMessage_limit(t *testing.T) {
+	//given
+	metrics := NewMetrics("", TestNamingService{}, 0, Options{})
+	metrics.deviceTracker.maxDevices = 2
+
+	//when
+	metrics.RecordMessage("unknownDevice1")
+	metrics.RecordMessage("unknownDevice2")
+	metrics.RecordMessage("unknownDevice3")
+	metrics.RecordMessage("unknownDevice1")
+
+	//then
+	if count := countSeries(metrics.deviceTracker.unknownCounter); count != 2 {
+		t.Errorf("RecordMessage() => devices over the limit should not be counted, got %d series", count)
+	}
+	if value := testutil.ToFloat64(metrics.deviceTracker.unknownCounter.WithLabelValues("unknownDevice1")); value != 2 {
+		t.Errorf("RecordMessage() => tracked unknown device messages = %v, want 2", value)
+	}
+}
+
+func TestMetrics_DevicesHandler(t *testing.T) {
+	//given
+	metrics := NewMetrics("", TestNamingService{}, 0, Options{})
+	seenAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	metrics.deviceTracker.now = func() time.Time { return seenAt }
+	metrics.RecordMessage(inputDeviceName)
+	metrics.RecordMessage(inputDeviceName)
+	metrics.RecordMessage("unknownDevice")
+	recorder := httptest.NewRecorder()
+
+	//when
+	metrics.DevicesHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/devices", nil))
+
+	//then
+	var report []deviceReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatalf("DevicesHandler() returned invalid JSON: %v", err)
+	}
+	expected := []deviceReport{
+		{Device: inputDeviceName, Configured: true, Name: expectedDeviceFName, Group: expectedDeviceGroup, LastSeen: seenAt, Messages: 2},
+		{Device: "unknownDevice", LastSeen: seenAt, Messages: 1},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("DevicesHandler() = %+v, want %+v", report, expected)
+	}
+}
+
+func TestMetrics_dropUnknownDevices(t *testing.T) {
+	//given
+	metrics := NewMetrics("", TestNamingService{}, 0, Options{DropUnknownDevices: true})
+	metrics.RegisterGauge(firstInputMetricsKey, "TestMetrics_dropUnknownDevices_gauge", inputMetricsDescription, inputLabelNames)
+	metrics.RegisterCounter(firstInputMetricsKey, "TestMetrics_dropUnknownDevices_counter", inputMetricsDescription, inputLabelNames)
+
+	//when
+	metrics.GaugeSet(firstInputMetricsKey, inputDeviceName, map[string]string{"label1": "a"}, 1)
+	metrics.GaugeSet(firstInputMetricsKey, "unknownDevice", map[string]string{"label1": "a"}, 1)
+	metrics.CounterInc(firstInputMetricsKey, "unknownDevice", map[string]string{"label1": "a"})
+
+	//then
+	if count := countSeries(metrics.gauges[firstInputMetricsKey].metric); count != 1 {
+		t.Errorf("GaugeSet() => expected only configured device series, got %d", count)
+	}
+	if count := countSeries(metrics.counters[firstInputMetricsKey].metric); count != 0 {
+		t.Errorf("CounterInc() => expected unknown device to be dropped, got %d series", count)
+	}
+}
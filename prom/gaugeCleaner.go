@@ -17,13 +17,6 @@ const (
 	MetricsRemovedCount = "cleaner_metrics_removed"
 )
 
-var (
-	MetricsUpdatesCounter   prometheus.Counter
-	MetricsLockTimeCounter  prometheus.Counter
-	MetricsExecutionCounter prometheus.Counter
-	MetricsRemovedCounter   prometheus.Counter
-)
-
 type clock interface {
 	Now() time.Time
 	After(d time.Duration) <-chan time.Time
@@ -44,30 +37,39 @@ type metricsUpdateDescriptor struct {
 	updateTime        time.Time
 }
 
+// gaugeVector is any vector which series can be removed by cleaner (gauges, histograms and summaries)
 type gaugeVector interface {
 	Delete(labels prometheus.Labels) bool
-	GetMetricWith(labels prometheus.Labels) (prometheus.Gauge, error)
+}
+
+const (
+	gaugeKind     = "gauge"
+	counterKind   = "counter"
+	histogramKind = "histogram"
+	summaryKind   = "summary"
+)
+
+// cleanerKey separates keys of metric types other than gauge, as modules use the same keys for e.g. counter and gauge
+func cleanerKey(kind string, key string) string {
+	return kind + ":" + key
 }
 
 type gaugeCleaner struct {
-	updates       map[string]metricsUpdateDescriptor
-	metrics       map[string]gaugeVector
-	input         chan metricsDescriptor
-	clk           clock
-	timeout       time.Duration
-	lock          sync.Mutex
-	metricsPrefix string
+	updates          map[string]metricsUpdateDescriptor
+	metrics          map[string]gaugeVector
+	input            chan metricsDescriptor
+	clk              clock
+	timeout          time.Duration
+	lock             sync.Mutex
+	metricsPrefix    string
+	updatesCounter   prometheus.Counter
+	lockTimeCounter  prometheus.Counter
+	executionCounter prometheus.Counter
+	removedCounter   prometheus.Counter
 }
 
 func NewGaugeCleaner(metricsPrefix string) *gaugeCleaner {
-	return &gaugeCleaner{
-		updates:       make(map[string]metricsUpdateDescriptor),
-		metrics:       make(map[string]gaugeVector),
-		input:         make(chan metricsDescriptor, 10),
-		clk:           &realClock{},
-		timeout:       0,
-		metricsPrefix: metricsPrefix,
-	}
+	return NewGaugeCleanerWithTimeout(0, metricsPrefix)
 }
 
 func NewGaugeCleanerWithTimeout(timeout time.Duration, metricsPrefix string) *gaugeCleaner {
@@ -78,6 +80,26 @@ func NewGaugeCleanerWithTimeout(timeout time.Duration, metricsPrefix string) *ga
 		clk:           &realClock{},
 		timeout:       timeout,
 		metricsPrefix: metricsPrefix,
+		updatesCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: metricsPrefix + "_" + MetricsUpdatesCount,
+				Help: "Count of registered metrics update",
+			}),
+		lockTimeCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: metricsPrefix + "_" + MetricsCleanTime,
+				Help: "Cumulative metrics clean time in seconds - lock time only",
+			}),
+		executionCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: metricsPrefix + "_" + MetricsCleanCount,
+				Help: "Number of clean process executions",
+			}),
+		removedCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: metricsPrefix + "_" + MetricsRemovedCount,
+				Help: "Removed metrics count",
+			}),
 	}
 }
 
@@ -88,11 +110,12 @@ func (gc *gaugeCleaner) Close() error {
 
 func (gc *gaugeCleaner) RegisterGauge(key string, vector gaugeVector) {
 	logger.Debug("gauge_cleaner", "Registering new gauge %+v under %s", vector, key)
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
 	gc.metrics[key] = vector
 }
 
 func (gc *gaugeCleaner) Run() {
-	gc.prepareMetrics()
 	if gc.timeout == 0 {
 		logger.Warn("gauge_cleaner", "Timeout is set to 0; disabling cleaner;")
 		return
@@ -101,36 +124,17 @@ func (gc *gaugeCleaner) Run() {
 	go gc.cleaner()
 }
 
-func (gc *gaugeCleaner) prepareMetrics() {
-	MetricsUpdatesCounter = prometheus.NewCounter(
-		prometheus.CounterOpts{
-			Name: gc.metricsPrefix + "_" + MetricsUpdatesCount,
-			Help: "Count of registered metrics update",
-		})
-	MetricsLockTimeCounter = prometheus.NewCounter(
-		prometheus.CounterOpts{
-			Name: gc.metricsPrefix + "_" + MetricsCleanTime,
-			Help: "Cumulative metrics clean time in seconds - lock time only",
-		})
-	MetricsExecutionCounter = prometheus.NewCounter(
-		prometheus.CounterOpts{
-			Name: gc.metricsPrefix + "_" + MetricsCleanCount,
-			Help: "Number of clean process executions",
-		})
-	MetricsRemovedCounter = prometheus.NewCounter(
-		prometheus.CounterOpts{
-			Name: gc.metricsPrefix + "_" + MetricsRemovedCount,
-			Help: "Removed metrics count",
-		})
-
-	err := prometheus.Register(MetricsExecutionCounter)
-	logger.Debug("gauge_cleaner", "%s register error: %v", MetricsCleanCount, err)
-	err = prometheus.Register(MetricsUpdatesCounter)
-	logger.Debug("gauge_cleaner", "%s register error: %v", MetricsUpdatesCount, err)
-	err = prometheus.Register(MetricsLockTimeCounter)
-	logger.Debug("gauge_cleaner", "%s register error: %v", MetricsCleanTime, err)
-	err = prometheus.Register(MetricsRemovedCounter)
-	logger.Debug("gauge_cleaner", "%s register error: %v", MetricsRemovedCount, err)
+// Register exports metrics of cleaner itself
+func (gc *gaugeCleaner) Register(registerer prometheus.Registerer) {
+	for name, counter := range map[string]prometheus.Counter{
+		MetricsCleanCount:   gc.executionCounter,
+		MetricsUpdatesCount: gc.updatesCounter,
+		MetricsCleanTime:    gc.lockTimeCounter,
+		MetricsRemovedCount: gc.removedCounter,
+	} {
+		err := registerer.Register(counter)
+		logger.Debug("gauge_cleaner", "%s register error: %v", name, err)
+	}
 }
 
 func (gc *gaugeCleaner) updateMetric(key string, labels map[string]string) {
@@ -139,7 +143,7 @@ func (gc *gaugeCleaner) updateMetric(key string, labels map[string]string) {
 		logger.Debug("gauge_cleaner", "Skipped update due to 0 timeout for %s, %+v", key, labels)
 		return
 	}
-	MetricsUpdatesCounter.Inc()
+	gc.updatesCounter.Inc()
 	gc.input <- metricsDescriptor{key: key, labels: labels}
 }
 
@@ -190,13 +194,13 @@ func (gc *gaugeCleaner) clean() {
 			logger.Info("gauge_cleaner", "Cleaning %s metrics for %+v", descriptor.metricsDescriptor.key, descriptor.metricsDescriptor.labels)
 			gc.metrics[descriptor.metricsDescriptor.key].Delete(descriptor.metricsDescriptor.labels)
 			delete(gc.updates, key)
-			MetricsRemovedCounter.Inc()
+			gc.removedCounter.Inc()
 		}
 	}
 	gc.lock.Unlock()
 	end := time.Now()
-	MetricsExecutionCounter.Inc()
-	MetricsLockTimeCounter.Add(end.Sub(start).Seconds())
+	gc.executionCounter.Inc()
+	gc.lockTimeCounter.Add(end.Sub(start).Seconds())
 	logger.Debug("gauge_cleaner", "Cleaning completed after %s", end.Sub(start))
 }
 
@@ -35,7 +35,8 @@ func (testGaugeVec) GetMetricWith(labels prometheus.Labels) (prometheus.Gauge, e
 
 func Test_gaugeCleaner_updateMetric(t *testing.T) {
 	//given
-	cleaner := &gaugeCleaner{input: make(chan metricsDescriptor, 1), clk: &testClock{current: startDate}, timeout: 1}
+	cleaner := NewGaugeCleanerWithTimeout(1, "")
+	cleaner.clk = &testClock{current: startDate}
 	defer cleaner.Close()
 
 	//when
@@ -59,7 +60,8 @@ func Test_gaugeCleaner_updateMetric(t *testing.T) {
 
 func Test_gaugeCleaner_updateMetric_shouldSkipWhenTimeoutIsZero(t *testing.T) {
 	//given
-	cleaner := &gaugeCleaner{input: make(chan metricsDescriptor, 1), clk: &testClock{current: startDate}}
+	cleaner := NewGaugeCleaner("")
+	cleaner.clk = &testClock{current: startDate}
 	defer cleaner.Close()
 
 	//when
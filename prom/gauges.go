@@ -1,37 +1,128 @@
 package prom
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"fmt"
+	"strings"
+	"time"
 
-func (metrics *Metrics) RegisterGauge(key string, name string, description string, labelNames []string) bool {
+	"github.com/klaper_/mqtt_data_exporter/backend"
+	"github.com/klaper_/mqtt_data_exporter/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func (metrics *Metrics) RegisterGauge(key string, name string, description string, labelNames []string) error {
+	return metrics.RegisterGaugeWithUnit(key, name, description, "", labelNames)
+}
+
+// RegisterGaugeWithUnit registers gauge with unit (e.g. "celsius") appended to its name, so it is exported under the same
+// name in every format; OpenMetrics format exposes the unit also as # UNIT metadata
+func (metrics *Metrics) RegisterGaugeWithUnit(key string, name string, description string, unit string, labelNames []string) error {
+	unit = sanitizeLabelName(unit)
+	if unit != "" && !strings.HasSuffix(name, "_"+unit) {
+		name += "_" + unit
+	}
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
 	_, ok := metrics.gauges[key]
 	if ok {
-		return false
-	}
-	labels := prepareLabelNames(labelNames)
-	metrics.gauges[key] = gaugeWithMetadata{
-		metric: prometheus.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: metrics.prefixName(name),
-				Help: description,
-			}, labels),
+		return metrics.registrationFailed(fmt.Errorf("%w: gauge %s", ErrKeyRegistered, key))
+	}
+	labels := metrics.prepareLabelNames(labelNames)
+	gauge := gaugeWithMetadata{
+		metric: newTimestampedGaugeVec(
+			prometheus.NewGaugeVec(
+				prometheus.GaugeOpts{
+					Name: metrics.prefixName(name),
+					Help: description,
+				}, labels),
+			labels,
+		),
 		labels: labels,
+		name:   metrics.prefixName(name),
+		unit:   unit,
+	}
+	if err := metrics.register(key, name, labelNames, gauge.metric); err != nil {
+		return err
 	}
-	metrics.gaugeCleaner.RegisterGauge(key, metrics.gauges[key].metric)
-	err := prometheus.Register(metrics.gauges[key].metric)
-	return err == nil
+	metrics.gauges[key] = gauge
+	metrics.gaugeCleaner.RegisterGauge(key, metrics.seriesLimiter.tracked(gaugeKind, key, gauge.metric))
+	return nil
 }
 
 func (metrics *Metrics) GaugeSet(key string, deviceName string, labels map[string]string, value float64) {
-	counter, found := metrics.gauges[key]
-	if !found {
+	counter, found := metrics.getGauge(key)
+	if !found || metrics.isDropped(deviceName) {
+		return
+	}
+	labelValues, ok := metrics.seriesValues(gaugeKind, key, deviceName, counter.labels, labels)
+	if !ok {
+		return
+	}
+	series := seriesLabels(counter.labels, labelValues)
+	written := counter.metric.Set(series, labelValues, value)
+	metrics.gaugeCleaner.updateMetric(key, series)
+	metrics.toSinks(backend.Gauge, counter.name, deviceName, series, written, time.Time{})
+}
+
+// GaugeAdd changes gauge value by delta, which can be negative
+func (metrics *Metrics) GaugeAdd(key string, deviceName string, labels map[string]string, delta float64) {
+	gauge, found := metrics.getGauge(key)
+	if !found || metrics.isDropped(deviceName) {
+		return
+	}
+	labelValues, ok := metrics.seriesValues(gaugeKind, key, deviceName, gauge.labels, labels)
+	if !ok {
 		return
 	}
-	labelValues := metrics.appendRestrictedToValues(deviceName, labels)
-	counter.metric.WithLabelValues(metrics.prepareLabelValues(counter.labels, labelValues)...).Set(value)
-	metrics.gaugeCleaner.updateMetric(key, labelValues)
+	series := seriesLabels(gauge.labels, labelValues)
+	written := gauge.metric.Add(series, labelValues, delta)
+	metrics.gaugeCleaner.updateMetric(key, series)
+	metrics.toSinks(backend.Gauge, gauge.name, deviceName, series, written, time.Time{})
+}
+
+func (metrics *Metrics) GaugeInc(key string, deviceName string, labels map[string]string) {
+	metrics.GaugeAdd(key, deviceName, labels, 1)
+}
+
+// GaugeSetWithTimestamp sets gauge value measured at given time (e.g. reported by device);
+// timestamp is exposed only when device timestamps are enabled, otherwise it works as GaugeSet
+func (metrics *Metrics) GaugeSetWithTimestamp(key string, deviceName string, labels map[string]string, value float64, timestamp time.Time) {
+	if !metrics.deviceTimestamps || timestamp.IsZero() {
+		metrics.GaugeSet(key, deviceName, labels, value)
+		return
+	}
+	counter, found := metrics.getGauge(key)
+	if !found || metrics.isDropped(deviceName) {
+		return
+	}
+	labelValues, ok := metrics.seriesValues(gaugeKind, key, deviceName, counter.labels, labels)
+	if !ok {
+		return
+	}
+	series := seriesLabels(counter.labels, labelValues)
+	written := counter.metric.SetWithTimestamp(series, labelValues, value, timestamp)
+	metrics.gaugeCleaner.updateMetric(key, series)
+	metrics.toSinks(backend.Gauge, counter.name, deviceName, series, written, timestamp)
+}
+
+// SensorGaugeSet sets gauge with readout of sensor field (e.g. "Pressure" of "BME280" sensor) after calibrating it
+// with sensor settings from naming configuration; readouts of disabled sensors and fields are dropped
+func (metrics *Metrics) SensorGaugeSet(key string, deviceName string, field string, labels map[string]string, value float64, timestamp time.Time) {
+	if deviceInfo, ok := metrics.propertiesProvider.GetProperties(deviceName); ok {
+		if settings, ok := deviceInfo.SensorSettings[labels["sensor_name"]]; ok {
+			var enabled bool
+			if value, enabled = settings.Apply(field, value); !enabled {
+				logger.Debug("prometheus", "dropping %s readout of disabled sensor %s of device %s", field, labels["sensor_name"], deviceName)
+				return
+			}
+		}
+	}
+	metrics.GaugeSetWithTimestamp(key, deviceName, labels, value, timestamp)
 }
 
 type gaugeWithMetadata struct {
-	metric *prometheus.GaugeVec
+	metric *timestampedGaugeVec
 	labels []string
+	name   string
+	unit   string
 }
@@ -1,12 +1,17 @@
 package prom
 
 import (
+	"errors"
 	"testing"
+	"time"
+
+	"github.com/klaper_/mqtt_data_exporter/devices"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestMetrics_RegisterGauge_Count(t *testing.T) {
 	//given
-	metrics := NewMetrics("", nil, 0)
+	metrics := NewMetrics("", nil, 0, Options{})
 	initialLen := len(metrics.gauges)
 
 	//when
@@ -20,7 +25,7 @@ func TestMetrics_RegisterGauge_Count(t *testing.T) {
 
 func TestMetrics_RegisterGauge_Key(t *testing.T) {
 	//given
-	metrics := NewMetrics("", nil, 0)
+	metrics := NewMetrics("", nil, 0, Options{})
 
 	//when
 	metrics.RegisterGauge(firstInputMetricsKey, firstInputMetricsName, inputMetricsDescription, inputLabelNames)
@@ -33,11 +38,11 @@ func TestMetrics_RegisterGauge_Key(t *testing.T) {
 
 func TestMetrics_RegisterGauge_MetricExists(t *testing.T) {
 	//given
-	metrics := NewMetrics("", nil, 0)
+	metrics := NewMetrics("", nil, 0, Options{})
 	metrics.RegisterGauge(firstInputMetricsKey, firstInputMetricsName, inputMetricsDescription, inputLabelNames)
 
 	//when
-	ok := metrics.RegisterGauge(
+	err := metrics.RegisterGauge(
 		firstInputMetricsKey,
 		"TestMetrics_RegisterGauge_MetricExists",
 		inputMetricsDescription,
@@ -45,18 +50,18 @@ func TestMetrics_RegisterGauge_MetricExists(t *testing.T) {
 	)
 
 	//then
-	if ok {
-		t.Errorf("RegisterMetric() = %v, want %v", ok, false)
+	if !errors.Is(err, ErrKeyRegistered) {
+		t.Errorf("RegisterMetric() = %v, want %v", err, ErrKeyRegistered)
 	}
 }
 
 func TestMetrics_RegisterGauge_MetricAdded(t *testing.T) {
 	//given
-	metrics := NewMetrics("", nil, 0)
+	metrics := NewMetrics("", nil, 0, Options{})
 	metrics.RegisterGauge(firstInputMetricsKey, firstInputMetricsName, inputMetricsDescription, inputLabelNames)
 
 	//when
-	ok := metrics.RegisterGauge(
+	err := metrics.RegisterGauge(
 		secondInputMetricsKey,
 		"TestMetrics_RegisterGauge_MetricAdded",
 		inputMetricsDescription,
@@ -64,7 +69,61 @@ func TestMetrics_RegisterGauge_MetricAdded(t *testing.T) {
 	)
 
 	//then
-	if !ok {
-		t.Errorf("RegisterMetric() = %v, want %v", ok, true)
+	if err != nil {
+		t.Errorf("RegisterMetric() = %v, want %v", err, nil)
+	}
+}
+
+type CalibratedNamingService struct{}
+
+func (t CalibratedNamingService) GetProperties(deviceName string) (*devices.Properties, bool) {
+	return &devices.Properties{Name: expectedDeviceFName, Device: expectedDeviceName, Group: expectedDeviceGroup, SensorSettings: map[string]devices.SensorSettings{
+		"BME280": {Location: "shelf", Enabled: true, Offset: -0.5, Scale: 1, Fields: map[string]devices.FieldSettings{
+			"Pressure": {Enabled: false, Scale: 1},
+		}},
+	}}, true
+}
+
+func (t CalibratedNamingService) GetDefaultLabels() map[string]string {
+	return map[string]string{}
+}
+
+func TestMetrics_SensorGaugeSet(t *testing.T) {
+	//given
+	metrics := NewMetrics("", CalibratedNamingService{}, 0, Options{})
+	metrics.RegisterGauge("temperature", "TestMetrics_SensorGaugeSet_temperature", inputMetricsDescription, []string{"sensor_name"})
+	metrics.RegisterGauge("pressure", "TestMetrics_SensorGaugeSet_pressure", inputMetricsDescription, []string{"sensor_name"})
+
+	//when
+	metrics.SensorGaugeSet("temperature", inputDeviceName, "Temperature", map[string]string{"sensor_name": "BME280"}, 21, time.Time{})
+	metrics.SensorGaugeSet("pressure", inputDeviceName, "Pressure", map[string]string{"sensor_name": "BME280"}, 1013, time.Time{})
+
+	//then
+	gauge := metrics.gauges["temperature"].metric.WithLabelValues(expectedDeviceName, expectedDeviceGroup, expectedDeviceFName, "BME280", "BME280", "shelf")
+	if value := testutil.ToFloat64(gauge); value != 20.5 {
+		t.Errorf("SensorGaugeSet() => calibrated value = %v, want %v", value, 20.5)
+	}
+	if count := countSeries(metrics.gauges["pressure"].metric); count != 0 {
+		t.Errorf("SensorGaugeSet() => disabled field should be dropped, got %d series", count)
+	}
+}
+
+func TestMetrics_GaugeAdd(t *testing.T) {
+	//given
+	metrics := NewMetrics("", TestNamingService{}, 0, Options{DeviceTimestamps: true})
+	metrics.RegisterGauge(firstInputMetricsKey, firstInputMetricsName, inputMetricsDescription, []string{})
+	metrics.GaugeSetWithTimestamp(firstInputMetricsKey, inputDeviceName, map[string]string{}, 10, startDate)
+
+	//when
+	metrics.GaugeAdd(firstInputMetricsKey, inputDeviceName, map[string]string{}, -2.5)
+	metrics.GaugeInc(firstInputMetricsKey, inputDeviceName, map[string]string{})
+
+	//then
+	gauge := metrics.gauges[firstInputMetricsKey]
+	if value := testutil.ToFloat64(gauge.metric.WithLabelValues(expectedDeviceName, expectedDeviceGroup, expectedDeviceFName)); value != 8.5 {
+		t.Errorf("GaugeAdd() => value = %v, want %v", value, 8.5)
+	}
+	if len(gauge.metric.timestamps) != 0 {
+		t.Errorf("GaugeAdd() => expected device timestamp to be dropped, got %v", gauge.metric.timestamps)
 	}
 }
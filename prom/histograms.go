@@ -0,0 +1,84 @@
+package prom
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// observerVector is common part of histogram and summary vectors
+type observerVector interface {
+	prometheus.Collector
+	WithLabelValues(labelValues ...string) prometheus.Observer
+	Delete(labels prometheus.Labels) bool
+}
+
+type observerWithMetadata struct {
+	metric observerVector
+	labels []string
+}
+
+// RegisterHistogram registers histogram with given buckets (upper bounds in increasing order);
+// prometheus.DefBuckets are used when buckets are empty
+func (metrics *Metrics) RegisterHistogram(key string, name string, description string, labelNames []string, buckets []float64) error {
+	labels := metrics.prepareLabelNames(labelNames)
+	return metrics.registerObserver(metrics.histograms, histogramKind, key, name, labelNames, labels, func() observerVector {
+		return prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    metrics.prefixName(name),
+				Help:    description,
+				Buckets: buckets,
+			}, labels)
+	})
+}
+
+// HistogramObserve adds observation (e.g. payload size) to histogram
+func (metrics *Metrics) HistogramObserve(key string, deviceName string, labels map[string]string, value float64) {
+	metrics.observe(metrics.histograms, histogramKind, key, deviceName, labels, value)
+}
+
+func (metrics *Metrics) registerObserver(observers map[string]observerWithMetadata, kind string, key string, name string, labelNames []string, labels []string, newVector func() observerVector) error {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	if _, ok := observers[key]; ok {
+		return metrics.registrationFailed(fmt.Errorf("%w: %s %s", ErrKeyRegistered, kind, key))
+	}
+	vector, err := newObserverVector(newVector, labels)
+	if err != nil {
+		return metrics.registrationFailed(fmt.Errorf("could not create %s metric %s: %w", key, metrics.prefixName(name), err))
+	}
+	if err := metrics.register(key, name, labelNames, vector); err != nil {
+		return err
+	}
+	observers[key] = observerWithMetadata{metric: vector, labels: labels}
+	metrics.gaugeCleaner.RegisterGauge(cleanerKey(kind, key), metrics.seriesLimiter.tracked(kind, key, vector))
+	return nil
+}
+
+// newObserverVector turns panic on invalid options (e.g. unsorted buckets or "le" label) into error;
+// histogram options are checked only when series is created, so probe series is created and removed
+func newObserverVector(newVector func() observerVector, labels []string) (vector observerVector, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			vector, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	vector = newVector()
+	probe := make([]string, len(labels))
+	vector.WithLabelValues(probe...)
+	vector.Delete(seriesLabels(labels, probe))
+	return vector, nil
+}
+
+func (metrics *Metrics) observe(observers map[string]observerWithMetadata, kind string, key string, deviceName string, labels map[string]string, value float64) {
+	observer, found := metrics.getObserver(observers, key)
+	if !found || metrics.isDropped(deviceName) {
+		return
+	}
+	labelValues, ok := metrics.seriesValues(kind, key, deviceName, observer.labels, labels)
+	if !ok {
+		return
+	}
+	observer.metric.WithLabelValues(labelValues...).Observe(value)
+	metrics.gaugeCleaner.updateMetric(cleanerKey(kind, key), seriesLabels(observer.labels, labelValues))
+}
@@ -0,0 +1,94 @@
+package prom
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics_RegisterHistogram(t *testing.T) {
+	type args struct {
+		key     string
+		name    string
+		labels  []string
+		buckets []float64
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{"default buckets", args{"default", "TestMetrics_RegisterHistogram_default", inputLabelNames, nil}, true},
+		{"custom buckets", args{"custom", "TestMetrics_RegisterHistogram_custom", inputLabelNames, []float64{1, 10, 100}}, true},
+		{"key exists", args{firstInputMetricsKey, "TestMetrics_RegisterHistogram_exists", inputLabelNames, nil}, false},
+		{"unsorted buckets", args{"unsorted", "TestMetrics_RegisterHistogram_unsorted", inputLabelNames, []float64{10, 1}}, false},
+		{"reserved label", args{"reserved", "TestMetrics_RegisterHistogram_reserved", []string{"le"}, nil}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//given
+			metrics := NewMetrics("", nil, 0, Options{})
+			metrics.RegisterHistogram(firstInputMetricsKey, firstInputMetricsName, inputMetricsDescription, inputLabelNames, nil)
+
+			//when
+			got := metrics.RegisterHistogram(tt.args.key, tt.args.name, inputMetricsDescription, tt.args.labels, tt.args.buckets)
+
+			//then
+			if (got == nil) != tt.want {
+				t.Errorf("RegisterHistogram() = %v, want success %v", got, tt.want)
+			}
+			if _, ok := metrics.histograms[tt.args.key]; ok != (tt.want || tt.args.key == firstInputMetricsKey) {
+				t.Errorf("RegisterHistogram() => histogram registered = %v", ok)
+			}
+		})
+	}
+}
+
+func TestMetrics_HistogramObserve(t *testing.T) {
+	//given
+	metrics := NewMetrics("prefix", TestNamingService{}, 0, Options{})
+	metrics.RegisterHistogram("payload", "payload_bytes", "Payload size", []string{"topic"}, []float64{10, 100})
+
+	//when
+	metrics.HistogramObserve("payload", inputDeviceName, map[string]string{"topic": "SENSOR"}, 5)
+	metrics.HistogramObserve("payload", inputDeviceName, map[string]string{"topic": "SENSOR"}, 50)
+	metrics.HistogramObserve("payload", inputDeviceName, map[string]string{"topic": "SENSOR"}, 500)
+	metrics.HistogramObserve("unknown", inputDeviceName, map[string]string{"topic": "SENSOR"}, 5)
+
+	//then
+	expected := `
+# HELP prefix_payload_bytes Payload size
+# TYPE prefix_payload_bytes histogram
+prefix_payload_bytes_bucket{device="deviceName",friendly_name="deviceFName",group="deviceGroup",topic="SENSOR",le="10"} 1
+prefix_payload_bytes_bucket{device="deviceName",friendly_name="deviceFName",group="deviceGroup",topic="SENSOR",le="100"} 2
+prefix_payload_bytes_bucket{device="deviceName",friendly_name="deviceFName",group="deviceGroup",topic="SENSOR",le="+Inf"} 3
+prefix_payload_bytes_sum{device="deviceName",friendly_name="deviceFName",group="deviceGroup",topic="SENSOR"} 555
+prefix_payload_bytes_count{device="deviceName",friendly_name="deviceFName",group="deviceGroup",topic="SENSOR"} 3
+`
+	if err := testutil.CollectAndCompare(metrics.histograms["payload"].metric, strings.NewReader(expected), "prefix_payload_bytes"); err != nil {
+		t.Errorf("HistogramObserve() unexpected result: %v", err)
+	}
+}
+
+func TestMetrics_HistogramObserve_cleaned(t *testing.T) {
+	//given
+	metrics := NewMetrics("", TestNamingService{}, 0, Options{})
+	clock := &testClock{current: startDate}
+	metrics.gaugeCleaner.timeout = time.Second
+	metrics.gaugeCleaner.clk = clock
+	metrics.RegisterHistogram("interval", "TestMetrics_HistogramObserve_cleaned", inputMetricsDescription, []string{"sensor_name"}, nil)
+	metrics.HistogramObserve("interval", inputDeviceName, map[string]string{"sensor_name": "BME280"}, 10)
+	metrics.gaugeCleaner.Close()
+	metrics.gaugeCleaner.receive()
+
+	//when
+	clock.MoveForward(2 * time.Second)
+	metrics.gaugeCleaner.clean()
+
+	//then
+	if count := countSeries(metrics.histograms["interval"].metric); count != 0 {
+		t.Errorf("clean() => expected histogram series to be removed, got %d series", count)
+	}
+}
@@ -0,0 +1,106 @@
+package prom
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/klaper_/mqtt_data_exporter/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+)
+
+// Handler serves metrics of the store. With openMetrics scrapers which negotiate it get OpenMetrics format
+// with _created samples of counters, units of gauges and exemplars.
+func (metrics *Metrics) Handler(openMetrics bool) http.Handler {
+	handler := promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{})
+	if openMetrics {
+		textHandler := handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+			if format.FormatType() != expfmt.TypeOpenMetrics {
+				textHandler.ServeHTTP(w, r)
+				return
+			}
+			metrics.serveOpenMetrics(w, format)
+		})
+	}
+	return promhttp.InstrumentMetricHandler(metrics.registry, handler)
+}
+
+// serveOpenMetrics encodes metrics itself, as promhttp does not expose units nor adds _total suffix to counters
+func (metrics *Metrics) serveOpenMetrics(w http.ResponseWriter, format expfmt.Format) {
+	families, err := metrics.gatherOpenMetrics()
+	if err != nil {
+		logger.Warn("prometheus", "Error gathering metrics: %v", err)
+		if len(families) == 0 {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", string(format))
+	encoder := expfmt.NewEncoder(w, format, expfmt.WithCreatedLines(), expfmt.WithUnit())
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			logger.Warn("prometheus", "Error encoding %s metric: %v", family.GetName(), err)
+			return
+		}
+	}
+	if closer, ok := encoder.(expfmt.Closer); ok {
+		if err := closer.Close(); err != nil {
+			logger.Warn("prometheus", "Error finishing metrics: %v", err)
+		}
+	}
+}
+
+// gatherOpenMetrics adds units of gauges and _total suffix of counters which do not have it, as OpenMetrics
+// types counters without the suffix as unknown (which can not have _created samples and exemplars)
+func (metrics *Metrics) gatherOpenMetrics() ([]*dto.MetricFamily, error) {
+	families, err := metrics.registry.Gather()
+	metrics.lock.RLock()
+	units := make(map[string]string, len(metrics.gauges))
+	for _, gauge := range metrics.gauges {
+		if gauge.unit != "" {
+			units[gauge.name] = gauge.unit
+		}
+	}
+	metrics.lock.RUnlock()
+	for _, family := range families {
+		if unit, ok := units[family.GetName()]; ok {
+			family.Unit = proto.String(unit)
+		}
+		if family.GetType() == dto.MetricType_COUNTER && !strings.HasSuffix(family.GetName(), "_total") {
+			family.Name = proto.String(family.GetName() + "_total")
+		}
+	}
+	return families, err
+}
+
+// exemplarLabels fits exemplar into prometheus.ExemplarMaxRunes, values which do not fit (e.g. long topics) are truncated
+func exemplarLabels(exemplar map[string]string) prometheus.Labels {
+	names := make([]string, 0, len(exemplar))
+	for name := range exemplar {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make(prometheus.Labels, len(exemplar))
+	left := prometheus.ExemplarMaxRunes
+	for _, name := range names {
+		left -= utf8.RuneCountInString(name)
+		if left < 0 {
+			break
+		}
+		value := []rune(exemplar[name])
+		if len(value) > left {
+			value = value[:left]
+		}
+		left -= len(value)
+		result[name] = string(value)
+	}
+	return result
+}
@@ -0,0 +1,145 @@
+package prom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+const openMetricsAccept = "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5"
+
+func TestMetrics_Handler(t *testing.T) {
+	tests := []struct {
+		name            string
+		openMetrics     bool
+		exemplars       bool
+		accept          string
+		wantContentType string
+		wantLines       []string
+		unwantedLines   []string
+	}{
+		{
+			name: "text format by default", openMetrics: false, exemplars: true, accept: openMetricsAccept,
+			wantContentType: "text/plain",
+			wantLines: []string{
+				`handler_messages{device="deviceName",friendly_name="deviceFName",group="deviceGroup"} 1`,
+				`handler_temperature_celsius{device="deviceName",friendly_name="deviceFName",group="deviceGroup"} 21.5`,
+			},
+			unwantedLines: []string{"# UNIT", "_created", "# {", "handler_messages_total"},
+		},
+		{
+			name: "text format when not negotiated", openMetrics: true, exemplars: true, accept: "text/plain",
+			wantContentType: "text/plain",
+			unwantedLines:   []string{"# UNIT", "_created", "# {"},
+		},
+		{
+			name: "openmetrics", openMetrics: true, exemplars: true, accept: openMetricsAccept,
+			wantContentType: "application/openmetrics-text",
+			wantLines: []string{
+				"# UNIT handler_temperature_celsius celsius",
+				`handler_temperature_celsius{device="deviceName",friendly_name="deviceFName",group="deviceGroup"} 21.5`,
+				"# TYPE handler_messages counter",
+				`handler_messages_total{device="deviceName",friendly_name="deviceFName",group="deviceGroup"} 1.0 # {`,
+				`message_id="7"`,
+				`topic="tele/deviceName/SENSOR"`,
+				`handler_messages_created{device="deviceName",friendly_name="deviceFName",group="deviceGroup"}`,
+				"# EOF",
+			},
+		},
+		{
+			name: "openmetrics without exemplars", openMetrics: true, exemplars: false, accept: openMetricsAccept,
+			wantContentType: "application/openmetrics-text",
+			wantLines:       []string{`handler_messages_total{device="deviceName",friendly_name="deviceFName",group="deviceGroup"} 1.0`},
+			unwantedLines:   []string{"# {"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//given
+			metrics := NewMetrics("handler", TestNamingService{}, 0, Options{Exemplars: tt.exemplars})
+			metrics.RegisterCounter("messages", "messages", inputMetricsDescription, []string{})
+			metrics.RegisterGaugeWithUnit("temperature", "temperature", inputMetricsDescription, "celsius", []string{})
+			metrics.CounterAddWithExemplar("messages", inputDeviceName, map[string]string{}, 1, map[string]string{"topic": "tele/deviceName/SENSOR", "message_id": "7"})
+			metrics.GaugeSet("temperature", inputDeviceName, map[string]string{}, 21.5)
+			request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			request.Header.Set("Accept", tt.accept)
+			response := httptest.NewRecorder()
+
+			//when
+			metrics.Handler(tt.openMetrics).ServeHTTP(response, request)
+
+			//then
+			body := response.Body.String()
+			if contentType := response.Header().Get("Content-Type"); !strings.HasPrefix(contentType, tt.wantContentType) {
+				t.Errorf("Content-Type = %s, want %s", contentType, tt.wantContentType)
+			}
+			for _, line := range tt.wantLines {
+				if !strings.Contains(body, line) {
+					t.Errorf("expected %q in:\n%s", line, body)
+				}
+			}
+			for _, line := range tt.unwantedLines {
+				if strings.Contains(body, line) {
+					t.Errorf("unexpected %q in:\n%s", line, body)
+				}
+			}
+		})
+	}
+}
+
+func TestMetrics_RegisterGaugeWithUnit(t *testing.T) {
+	tests := []struct {
+		name       string
+		metricName string
+		unit       string
+		want       string
+	}{
+		{"unit is appended", "temperature", "celsius", "unit_temperature_celsius"},
+		{"name with unit suffix is kept", "temperature_celsius", "celsius", "unit_temperature_celsius"},
+		{"no unit", "temperature", "", "unit_temperature"},
+		{"unit is sanitized", "energy", "kilo-watt hours", "unit_energy_kilo_watt_hours"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//given
+			metrics := NewMetrics("unit", TestNamingService{}, 0, Options{})
+
+			//when
+			err := metrics.RegisterGaugeWithUnit(firstInputMetricsKey, tt.metricName, inputMetricsDescription, tt.unit, []string{})
+
+			//then
+			if gauge := metrics.gauges[firstInputMetricsKey]; err != nil || gauge.name != tt.want {
+				t.Errorf("RegisterGaugeWithUnit() => name = %q, error = %v, want %q", gauge.name, err, tt.want)
+			}
+		})
+	}
+}
+
+func Test_exemplarLabels(t *testing.T) {
+	longTopic := "tele/" + strings.Repeat("device", 30) + "/SENSOR"
+	tests := []struct {
+		name     string
+		exemplar map[string]string
+		want     map[string]string
+	}{
+		{"short exemplar", map[string]string{"topic": "tele/device/SENSOR", "message_id": "1"}, map[string]string{"topic": "tele/device/SENSOR", "message_id": "1"}},
+		{"long topic is truncated", map[string]string{"topic": longTopic, "message_id": "1"}, map[string]string{"topic": longTopic[:128-len("message_id1topic")], "message_id": "1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := exemplarLabels(tt.exemplar)
+			runes := 0
+			for name, value := range got {
+				runes += utf8.RuneCountInString(name) + utf8.RuneCountInString(value)
+				if value != tt.want[name] {
+					t.Errorf("exemplarLabels() => %s = %q, want %q", name, value, tt.want[name])
+				}
+			}
+			if len(got) != len(tt.want) || runes > 128 {
+				t.Errorf("exemplarLabels() = %v, expected %d labels within 128 runes", got, len(tt.want))
+			}
+		})
+	}
+}
@@ -1,38 +1,157 @@
 package prom
 
 import (
-	"github.com/klaper_/mqtt_data_exporter/devices"
-	"github.com/klaper_/mqtt_data_exporter/logger"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/klaper_/mqtt_data_exporter/backend"
+	"github.com/klaper_/mqtt_data_exporter/devices"
+	"github.com/klaper_/mqtt_data_exporter/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 type DevicePropertiesProvider interface {
 	GetProperties(deviceName string) (*devices.Properties, bool)
+	GetDefaultLabels() map[string]string
 }
 
+// Metrics exports its metrics in own registry, so every instance (e.g. in tests) can register the same metric names
 type Metrics struct {
+	lock               sync.RWMutex
+	registry           *prometheus.Registry
 	counters           map[string]counterWithMetadata
 	gauges             map[string]gaugeWithMetadata
+	histograms         map[string]observerWithMetadata
+	summaries          map[string]observerWithMetadata
 	propertiesProvider DevicePropertiesProvider
 	metricsNamePrefix  string
 	gaugeCleaner       *gaugeCleaner
+	deviceTimestamps   bool
+	dropUnknownDevices bool
+	deviceInfo         bool
+	cleanCounters      bool
+	customLabels       map[string]string
+	customLabelNames   []string
+	deviceTracker      *deviceTracker
+	unregisteredWrites *prometheus.CounterVec
+	registrationErrors []error
+	metricNames        map[string]string
+	seriesLimiter      *seriesLimiter
+	exemplars          bool
+	sinks              []backend.Sink
 }
 
-func NewMetrics(metricsNamePrefix string, propertiesProvider DevicePropertiesProvider, metricsCleanerTimeout time.Duration) *Metrics {
+// Options enable optional behaviour of Metrics; zero value keeps the default one
+type Options struct {
+	// DeviceTimestamps exposes gauges with time reported by device instead of scrape time
+	DeviceTimestamps bool
+	// DropUnknownDevices drops metrics of devices missing in naming configuration
+	DropUnknownDevices bool
+	// DeviceInfo exports device properties in device_info metric only, other metrics keep just device label
+	DeviceInfo bool
+	// CleanCounters lets gauge cleaner remove also counters of devices which were not updated
+	CleanCounters bool
+	SeriesLimits  SeriesLimits
+	// Exemplars are attached to counters written with CounterAddWithExemplar
+	Exemplars bool
+}
+
+func NewMetrics(metricsNamePrefix string, propertiesProvider DevicePropertiesProvider, metricsCleanerTimeout time.Duration, options Options) *Metrics {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 	gaugeCleaner := NewGaugeCleanerWithTimeout(metricsCleanerTimeout, metricsNamePrefix)
+	gaugeCleaner.Register(registry)
 	gaugeCleaner.Run()
-	return &Metrics{
+	customLabels := make(map[string]string)
+	if propertiesProvider != nil {
+		customLabels = propertiesProvider.GetDefaultLabels()
+	}
+	customLabelNames := make([]string, 0, len(customLabels))
+	for name := range customLabels {
+		customLabelNames = append(customLabelNames, name)
+	}
+	sort.Strings(customLabelNames)
+	metrics := &Metrics{
+		registry:           registry,
 		counters:           make(map[string]counterWithMetadata),
 		gauges:             make(map[string]gaugeWithMetadata),
+		histograms:         make(map[string]observerWithMetadata),
+		summaries:          make(map[string]observerWithMetadata),
+		metricNames:        make(map[string]string),
+		exemplars:          options.Exemplars,
 		propertiesProvider: propertiesProvider,
 		metricsNamePrefix:  strings.Trim(metricsNamePrefix, "_"),
 		gaugeCleaner:       gaugeCleaner,
+		deviceTimestamps:   options.DeviceTimestamps,
+		dropUnknownDevices: options.DropUnknownDevices,
+		deviceInfo:         options.DeviceInfo,
+		cleanCounters:      options.CleanCounters,
+		customLabels:       customLabels,
+		customLabelNames:   customLabelNames,
+	}
+	metrics.deviceTracker = newDeviceTracker(metrics.prefixName(UnknownDeviceMessagesCount), registry)
+	metrics.unregisteredWrites = newUnregisteredWritesCounter(metrics.prefixName(UnregisteredWritesCount))
+	registry.MustRegister(metrics.unregisteredWrites)
+	metrics.seriesLimiter = newSeriesLimiter(options.SeriesLimits, metrics.prefixName(SeriesLimitDroppedCount))
+	registry.MustRegister(metrics.seriesLimiter.dropped)
+	if options.DeviceInfo {
+		newDeviceInfoCollector(metrics)
+	}
+	return metrics
+}
+
+// Registerer lets other components export their metrics together with the ones of the store
+func (metrics *Metrics) Registerer() prometheus.Registerer {
+	return metrics.registry
+}
+
+// Gatherer gives all metrics of the store, e.g. to push them where exporter can not be scraped
+func (metrics *Metrics) Gatherer() prometheus.Gatherer {
+	return metrics.registry
+}
+
+// getCounter, getObserver and getGauge are used by writes only, so missing keys are counted as writes to unregistered metrics
+func (metrics *Metrics) getCounter(key string) (counterWithMetadata, bool) {
+	metrics.lock.RLock()
+	defer metrics.lock.RUnlock()
+	counter, found := metrics.counters[key]
+	if !found {
+		metrics.unregisteredWrite(key)
+	}
+	return counter, found
+}
+
+func (metrics *Metrics) getObserver(observers map[string]observerWithMetadata, key string) (observerWithMetadata, bool) {
+	metrics.lock.RLock()
+	defer metrics.lock.RUnlock()
+	observer, found := observers[key]
+	if !found {
+		metrics.unregisteredWrite(key)
 	}
+	return observer, found
+}
+
+func (metrics *Metrics) getGauge(key string) (gaugeWithMetadata, bool) {
+	metrics.lock.RLock()
+	defer metrics.lock.RUnlock()
+	gauge, found := metrics.gauges[key]
+	if !found {
+		metrics.unregisteredWrite(key)
+	}
+	return gauge, found
 }
 
 func (metrics *Metrics) prefixName(name string) string {
-	return metrics.metricsNamePrefix + "_" + strings.Trim(name, "_")
+	return sanitizeMetricName(metrics.metricsNamePrefix + "_" + strings.Trim(name, "_"))
+}
+
+// seriesValues completes label values of series and applies series limits; returns false when series is dropped
+func (metrics *Metrics) seriesValues(kind string, key string, deviceName string, labelNames []string, labels map[string]string) ([]string, bool) {
+	labelValues := metrics.prepareLabelValues(labelNames, metrics.appendRestrictedToValues(deviceName, labels))
+	return metrics.seriesLimiter.admit(kind, key, labelNames, labelValues)
 }
 
 func (metrics *Metrics) prepareLabelValues(labelNames []string, labelValues map[string]string) []string {
@@ -43,11 +162,20 @@ func (metrics *Metrics) prepareLabelValues(labelNames []string, labelValues map[
 	return result
 }
 
+// seriesLabels pairs label names of vector with values of single series, as expected by Delete
+func seriesLabels(labelNames []string, labelValues []string) map[string]string {
+	result := make(map[string]string, len(labelNames))
+	for i, name := range labelNames {
+		result[name] = labelValues[i]
+	}
+	return result
+}
+
 func (metrics *Metrics) appendRestrictedToValues(deviceName string, labels map[string]string) map[string]string {
 	deviceInfo, ok := metrics.propertiesProvider.GetProperties(deviceName)
 	result := make(map[string]string)
 	for k, v := range labels {
-		result[k] = v
+		result[sanitizeLabelName(k)] = v
 	}
 	if !ok {
 		deviceInfo = &devices.Properties{Name: deviceName, Group: "", Device: deviceName, Sensors: make(map[string]string, 0)}
@@ -55,10 +183,20 @@ func (metrics *Metrics) appendRestrictedToValues(deviceName string, labels map[s
 	result["device"] = deviceInfo.Device
 	result["group"] = deviceInfo.Group
 	result["friendly_name"] = deviceInfo.Name
+	for name, defaultValue := range metrics.customLabels {
+		if value, ok := deviceInfo.Labels[name]; ok {
+			result[name] = value
+		} else {
+			result[name] = defaultValue
+		}
+	}
 	if alias, ok := getSensorAlias(labels, deviceInfo); ok {
 		logger.Debug("prometheus_naming", "setting (%q,%b) sensor alias for device %s", alias, ok, deviceName)
 		result["sensor_alias"] = alias
 	}
+	if settings, ok := deviceInfo.SensorSettings[labels["sensor_name"]]; ok && settings.Location != "" {
+		result["sensor_location"] = settings.Location
+	}
 	logger.Debug("prometheus_naming", "returning %+v labels", result)
 	return result
 }
@@ -76,12 +214,34 @@ func getSensorAlias(labels map[string]string, deviceInfo *devices.Properties) (s
 	return "", false
 }
 
-func prepareLabelNames(labelNames []string) []string {
-	result := restrictedLabelNames
+func (metrics *Metrics) prepareLabelNames(labelNames []string) []string {
+	result := prepareLabelNames(labelNames, metrics.customLabelNames...)
+	if metrics.deviceInfo {
+		return withoutDeviceProperties(result, metrics.customLabelNames)
+	}
+	return result
+}
+
+// withoutDeviceProperties keeps only "device" of restricted and custom labels, the rest is exposed by device_info metric
+func withoutDeviceProperties(labelNames []string, customLabelNames []string) (result []string) {
+	for _, label := range labelNames {
+		if label == "device" || (!contains(restrictedLabelNames, label) && !contains(customLabelNames, label)) {
+			result = append(result, label)
+		}
+	}
+	return
+}
+
+// prepareLabelNames puts restricted and custom (from naming configuration) labels first, renaming clashing module labels to "module_"
+func prepareLabelNames(labelNames []string, customLabelNames ...string) []string {
+	restricted := make([]string, 0, len(restrictedLabelNames)+len(customLabelNames))
+	restricted = append(restricted, restrictedLabelNames...)
+	restricted = append(restricted, customLabelNames...)
+	result := append([]string{}, restricted...)
 
 	for label := range labelNames {
-		l := labelNames[label]
-		if contains(restrictedLabelNames, l) {
+		l := sanitizeLabelName(labelNames[label])
+		if contains(restricted, l) {
 			l = "module_" + l
 		}
 		if contains(result, l) {
@@ -94,8 +254,8 @@ func prepareLabelNames(labelNames []string) []string {
 
 func appendDynamicLabels(labels []string) (result []string) {
 	for _, v := range labels {
-		if value, ok := dynamicLabels[v]; ok {
-			result = append(result, value)
+		if values, ok := dynamicLabels[v]; ok {
+			result = append(result, values...)
 		}
 	}
 	return append(labels, result...)
@@ -110,5 +270,5 @@ func contains(a []string, x string) bool {
 	return false
 }
 
-var dynamicLabels = map[string]string{"sensor_name": "sensor_alias"}
+var dynamicLabels = map[string][]string{"sensor_name": {"sensor_alias", "sensor_location"}}
 var restrictedLabelNames = []string{"device", "group", "friendly_name"}
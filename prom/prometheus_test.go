@@ -2,7 +2,9 @@ package prom
 
 import (
 	"github.com/klaper_/mqtt_data_exporter/devices"
+	"github.com/prometheus/client_golang/prometheus"
 	"reflect"
+	"sync"
 	"testing"
 )
 
@@ -25,7 +27,7 @@ var (
 
 //BenchmarkMetrics_prefixName-8          	 6310520	       188 ns/op
 func BenchmarkMetrics_prefixName(b *testing.B) {
-	metrics := NewMetrics("_prefix_", nil, 0)
+	metrics := NewMetrics("_prefix_", nil, 0, Options{})
 	var r string
 	for i := 0; i < b.N; i++ {
 		r = metrics.prefixName("_n_a_m_e_")
@@ -91,7 +93,7 @@ func TestNewMetrics_PrefixTrim(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := NewMetrics(tt.args.metricsNamePrefix, tt.args.namer, 0); got.metricsNamePrefix != tt.want {
+			if got := NewMetrics(tt.args.metricsNamePrefix, tt.args.namer, 0, Options{}); got.metricsNamePrefix != tt.want {
 				t.Errorf("NewMetrics() = %v, want %v", got.metricsNamePrefix, tt.want)
 			}
 		})
@@ -110,7 +112,7 @@ func Test_prepareLabelValues(t *testing.T) {
 		{"empty set", args{labelNames: []string{}}, restrictedLabels},
 		{"adding sets", args{labelNames: []string{"Label1"}}, append(restrictedLabels, "Label1")},
 		{"repeating input", args{labelNames: []string{"Label1", "Label1"}}, append(restrictedLabels, "Label1")},
-		{"repeating input", args{labelNames: []string{"sensor_name"}}, append(restrictedLabels, "sensor_name", "sensor_alias")},
+		{"repeating input", args{labelNames: []string{"sensor_name"}}, append(restrictedLabels, "sensor_name", "sensor_alias", "sensor_location")},
 		{
 			"adding sets and renaming to module_",
 			args{labelNames: []string{restrictedLabels[0]}},
@@ -355,3 +357,157 @@ func (t TestNamingService) GetProperties(deviceName string) (*devices.Properties
 	}
 	return nil, false
 }
+
+func (t TestNamingService) GetDefaultLabels() map[string]string {
+	return map[string]string{}
+}
+
+func TestMetrics_RetireDevices(t *testing.T) {
+	//given
+	metrics := NewMetrics("", TestNamingService{}, 0, Options{})
+	metrics.RegisterGauge(firstInputMetricsKey, "TestMetrics_RetireDevices_gauge", inputMetricsDescription, inputLabelNames)
+	metrics.RegisterCounter(firstInputMetricsKey, "TestMetrics_RetireDevices_counter", inputMetricsDescription, inputLabelNames)
+	metrics.GaugeSet(firstInputMetricsKey, inputDeviceName, map[string]string{"label1": "a"}, 1)
+	metrics.GaugeSet(firstInputMetricsKey, "otherDevice", map[string]string{"label1": "a"}, 1)
+	metrics.CounterInc(firstInputMetricsKey, inputDeviceName, map[string]string{"label1": "a"})
+
+	//when
+	metrics.RetireDevices([]string{expectedDeviceName})
+
+	//then
+	if count := countSeries(metrics.gauges[firstInputMetricsKey].metric); count != 1 {
+		t.Errorf("RetireDevices(): expected 1 gauge series left, got %d", count)
+	}
+	if count := countSeries(metrics.counters[firstInputMetricsKey].metric); count != 0 {
+		t.Errorf("RetireDevices(): expected 0 counter series left, got %d", count)
+	}
+}
+
+func countSeries(collector prometheus.Collector) int {
+	ch := make(chan prometheus.Metric, 10)
+	collector.Collect(ch)
+	close(ch)
+	return len(ch)
+}
+
+func Test_prepareLabelNames_customLabels(t *testing.T) {
+	//given
+	customLabels := []string{"floor", "room"}
+
+	//when
+	result := prepareLabelNames([]string{"room", "label1"}, customLabels...)
+
+	//then
+	expected := append(append([]string{}, restrictedLabels...), "floor", "room", "module_room", "label1")
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("prepareLabelNames() = %v, want %v", result, expected)
+	}
+}
+
+func TestMetrics_appendRestrictedToValues_customLabels(t *testing.T) {
+	//given
+	metrics := NewMetrics("", LabeledNamingService{}, 0, Options{})
+
+	//when
+	configured := metrics.appendRestrictedToValues(inputDeviceName, map[string]string{})
+	unknown := metrics.appendRestrictedToValues("unknownDevice", map[string]string{})
+
+	//then
+	if configured["floor"] != "ground" || configured["room"] != "default_room" {
+		t.Errorf("appendRestrictedToValues() for configured device = %v", configured)
+	}
+	if unknown["floor"] != "default_floor" || unknown["room"] != "default_room" {
+		t.Errorf("appendRestrictedToValues() for unknown device = %v", unknown)
+	}
+	if !reflect.DeepEqual(metrics.customLabelNames, []string{"floor", "room"}) {
+		t.Errorf("customLabelNames = %v, want sorted custom labels", metrics.customLabelNames)
+	}
+}
+
+type LabeledNamingService struct{}
+
+func (t LabeledNamingService) GetProperties(deviceName string) (*devices.Properties, bool) {
+	if deviceName == inputDeviceName {
+		return &devices.Properties{Name: expectedDeviceFName, Device: expectedDeviceName, Group: expectedDeviceGroup, Labels: map[string]string{"floor": "ground"}}, true
+	}
+	return nil, false
+}
+
+func (t LabeledNamingService) GetDefaultLabels() map[string]string {
+	return map[string]string{"room": "default_room", "floor": "default_floor"}
+}
+
+func TestNewMetrics_ownRegistry(t *testing.T) {
+	//given
+	first := NewMetrics("registry", TestNamingService{}, 0, Options{})
+	second := NewMetrics("registry", TestNamingService{}, 0, Options{})
+
+	//when
+	firstErr := first.RegisterGauge(firstInputMetricsKey, firstInputMetricsName, inputMetricsDescription, inputLabelNames)
+	secondErr := second.RegisterGauge(firstInputMetricsKey, firstInputMetricsName, inputMetricsDescription, inputLabelNames)
+	first.GaugeSet(firstInputMetricsKey, inputDeviceName, map[string]string{"label1": "a", "label2": "b"}, 1)
+
+	//then
+	if firstErr != nil || secondErr != nil {
+		t.Errorf("RegisterGauge() = (%v, %v), expected the same metric to be registered in both stores", firstErr, secondErr)
+	}
+	if count := countGathered(t, first.registry, "registry_"+firstInputMetricsName); count != 1 {
+		t.Errorf("first store exposes %d series, expected 1", count)
+	}
+	if count := countGathered(t, second.registry, "registry_"+firstInputMetricsName); count != 0 {
+		t.Errorf("second store exposes %d series, expected 0", count)
+	}
+}
+
+func TestMetrics_concurrentRegistration(t *testing.T) {
+	//given
+	metrics := NewMetrics("concurrent", TestNamingService{}, 0, Options{})
+	keys := []string{"first", "second", "third", "fourth"}
+	registered := make(chan bool, 2*len(keys)*10)
+	var wg sync.WaitGroup
+
+	//when
+	for i := 0; i < 10; i++ {
+		for _, key := range keys {
+			wg.Add(1)
+			go func(key string) {
+				defer wg.Done()
+				registered <- metrics.RegisterGauge(key, key, inputMetricsDescription, inputLabelNames) == nil
+				metrics.GaugeSet(key, inputDeviceName, map[string]string{"label1": "a"}, 1)
+				registered <- metrics.RegisterCounter(key, key+"_total", inputMetricsDescription, inputLabelNames) == nil
+				metrics.CounterInc(key, inputDeviceName, map[string]string{"label1": "a"})
+			}(key)
+		}
+	}
+	wg.Wait()
+	close(registered)
+
+	//then
+	succeeded := 0
+	for ok := range registered {
+		if ok {
+			succeeded++
+		}
+	}
+	if succeeded != 2*len(keys) {
+		t.Errorf("%d registrations succeeded, expected %d", succeeded, 2*len(keys))
+	}
+	for _, key := range keys {
+		if count := countGathered(t, metrics.registry, "concurrent_"+key); count != 1 {
+			t.Errorf("%s exposes %d series, expected 1", key, count)
+		}
+	}
+}
+
+func countGathered(t *testing.T, gatherer prometheus.Gatherer, name string) int {
+	families, err := gatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == name {
+			return len(family.GetMetric())
+		}
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+package prom
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/klaper_/mqtt_data_exporter/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const UnregisteredWritesCount = "unregistered_metric_writes_total"
+
+// ErrKeyRegistered is returned when metric of the same type is already registered under the key
+var ErrKeyRegistered = errors.New("metric key is already registered")
+
+func newUnregisteredWritesCounter(name string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: name,
+			Help: "Count of writes to metric keys which were not registered (or failed to register)",
+		}, []string{"key"})
+}
+
+// register adds metric to registry; has to be called with metrics lock held
+func (metrics *Metrics) register(key string, name string, labelNames []string, collector prometheus.Collector) error {
+	err := metrics.checkNameCollision(name)
+	if err == nil {
+		err = checkLabelCollisions(labelNames)
+	}
+	if err == nil {
+		err = metrics.registry.Register(collector)
+	}
+	if err != nil {
+		return metrics.registrationFailed(fmt.Errorf("could not register %s metric %s: %w", key, metrics.prefixName(name), err))
+	}
+	metrics.metricNames[metrics.prefixName(name)] = name
+	return nil
+}
+
+// registrationFailed remembers registration error; has to be called with metrics lock held
+func (metrics *Metrics) registrationFailed(err error) error {
+	logger.Warn("prometheus", "%v", err)
+	metrics.registrationErrors = append(metrics.registrationErrors, err)
+	return err
+}
+
+// RegistrationErrors returns errors of all failed registrations, so startup can be failed in strict mode
+func (metrics *Metrics) RegistrationErrors() []error {
+	metrics.lock.RLock()
+	defer metrics.lock.RUnlock()
+	return append([]error{}, metrics.registrationErrors...)
+}
+
+func (metrics *Metrics) unregisteredWrite(key string) {
+	logger.Debug("prometheus", "Write to unregistered metric %s", key)
+	metrics.unregisteredWrites.WithLabelValues(key).Inc()
+}
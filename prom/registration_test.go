@@ -0,0 +1,103 @@
+package prom
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics_register_errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(metrics *Metrics) error
+		wantErr  bool
+	}{
+		{"gauge", func(metrics *Metrics) error {
+			return metrics.RegisterGauge("other", "other_gauge", inputMetricsDescription, inputLabelNames)
+		}, false},
+		{"gauge name collision", func(metrics *Metrics) error {
+			return metrics.RegisterGauge("other", firstInputMetricsName, inputMetricsDescription, inputLabelNames)
+		}, true},
+		{"counter name collision with different labels", func(metrics *Metrics) error {
+			return metrics.RegisterCounter("other", firstInputMetricsName, inputMetricsDescription, []string{"label3"})
+		}, true},
+		{"sanitized metric name", func(metrics *Metrics) error {
+			return metrics.RegisterGauge("other", "tasmota_sensor_pm2.5", inputMetricsDescription, inputLabelNames)
+		}, false},
+		{"sanitized metric name collision", func(metrics *Metrics) error {
+			return metrics.RegisterGauge("other", "some-metric.name", inputMetricsDescription, inputLabelNames)
+		}, true},
+		{"sanitized label name", func(metrics *Metrics) error {
+			return metrics.RegisterCounter("other", "other_total", inputMetricsDescription, []string{"sensor-name"})
+		}, false},
+		{"sanitized label name collision", func(metrics *Metrics) error {
+			return metrics.RegisterCounter("other", "other_total", inputMetricsDescription, []string{"sensor-name", "sensor.name"})
+		}, true},
+		{"histogram name collision", func(metrics *Metrics) error {
+			return metrics.RegisterHistogram("other", firstInputMetricsName, inputMetricsDescription, inputLabelNames, nil)
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//given
+			metrics := NewMetrics("prefix", nil, 0, Options{})
+			for key, name := range map[string]string{firstInputMetricsKey: firstInputMetricsName, secondInputMetricsKey: "some_metric_name"} {
+				if err := metrics.RegisterGauge(key, name, inputMetricsDescription, inputLabelNames); err != nil {
+					t.Fatalf("RegisterGauge() = %v", err)
+				}
+			}
+
+			//when
+			err := tt.register(metrics)
+
+			//then
+			if (err != nil) != tt.wantErr {
+				t.Errorf("register = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errs := metrics.RegistrationErrors(); (len(errs) == 1) != tt.wantErr || (tt.wantErr && errs[0] != err) {
+				t.Errorf("RegistrationErrors() = %v, expected to contain only %v", errs, err)
+			}
+			if _, ok := metrics.gauges["other"]; ok && tt.wantErr {
+				t.Errorf("register => metric which failed to register should not be kept")
+			}
+		})
+	}
+}
+
+func TestMetrics_register_collisionCause(t *testing.T) {
+	//given
+	metrics := NewMetrics("prefix", nil, 0, Options{})
+	metrics.RegisterGauge(firstInputMetricsKey, firstInputMetricsName, inputMetricsDescription, inputLabelNames)
+
+	//when
+	err := metrics.RegisterGauge(secondInputMetricsKey, firstInputMetricsName, inputMetricsDescription, inputLabelNames)
+
+	//then
+	var collision prometheus.AlreadyRegisteredError
+	if !errors.As(err, &collision) {
+		t.Errorf("RegisterGauge() = %v, expected to wrap %T", err, collision)
+	}
+}
+
+func TestMetrics_unregisteredWrites(t *testing.T) {
+	//given
+	metrics := NewMetrics("", TestNamingService{}, 0, Options{})
+	metrics.RegisterGauge(firstInputMetricsKey, firstInputMetricsName, inputMetricsDescription, []string{})
+
+	//when
+	metrics.GaugeSet(firstInputMetricsKey, inputDeviceName, map[string]string{}, 1)
+	metrics.GaugeSet("missing_gauge", inputDeviceName, map[string]string{}, 1)
+	metrics.GaugeAdd("missing_gauge", inputDeviceName, map[string]string{}, 1)
+	metrics.CounterInc("missing_counter", inputDeviceName, map[string]string{})
+	metrics.HistogramObserve("missing_histogram", inputDeviceName, map[string]string{}, 1)
+
+	//then
+	expected := map[string]float64{firstInputMetricsKey: 0, "missing_gauge": 2, "missing_counter": 1, "missing_histogram": 1}
+	for key, want := range expected {
+		if value := testutil.ToFloat64(metrics.unregisteredWrites.WithLabelValues(key)); value != want {
+			t.Errorf("unregistered writes of %s = %v, want %v", key, value, want)
+		}
+	}
+}
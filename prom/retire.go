@@ -0,0 +1,62 @@
+package prom
+
+import (
+	"github.com/klaper_/mqtt_data_exporter/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// RetireDevices removes all series of given devices, so they are recreated with current device properties on next update
+func (metrics *Metrics) RetireDevices(deviceNames []string) {
+	if len(deviceNames) == 0 {
+		return
+	}
+	devices := make(map[string]bool, len(deviceNames))
+	for _, device := range deviceNames {
+		devices[device] = true
+	}
+	metrics.lock.RLock()
+	defer metrics.lock.RUnlock()
+	removed := 0
+	for key, counter := range metrics.counters {
+		removed += deleteDevicesSeries(counter.metric, metrics.seriesLimiter.tracked(counterKind, key, counter.metric).Delete, devices)
+	}
+	for key, gauge := range metrics.gauges {
+		removed += deleteDevicesSeries(gauge.metric, metrics.seriesLimiter.tracked(gaugeKind, key, gauge.metric).Delete, devices)
+	}
+	for kind, observers := range map[string]map[string]observerWithMetadata{histogramKind: metrics.histograms, summaryKind: metrics.summaries} {
+		for key, observer := range observers {
+			removed += deleteDevicesSeries(observer.metric, metrics.seriesLimiter.tracked(kind, key, observer.metric).Delete, devices)
+		}
+	}
+	logger.Info("prometheus", "Retired %d series of %d changed devices", removed, len(deviceNames))
+}
+
+func deleteDevicesSeries(collector prometheus.Collector, deleter func(prometheus.Labels) bool, devices map[string]bool) int {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(ch)
+		close(ch)
+	}()
+	toDelete := make([]prometheus.Labels, 0)
+	for metric := range ch {
+		written := &dto.Metric{}
+		if err := metric.Write(written); err != nil {
+			continue
+		}
+		labels := make(prometheus.Labels, len(written.Label))
+		for _, pair := range written.Label {
+			labels[pair.GetName()] = pair.GetValue()
+		}
+		if devices[labels["device"]] {
+			toDelete = append(toDelete, labels)
+		}
+	}
+	removed := 0
+	for _, labels := range toDelete {
+		if deleter(labels) {
+			removed++
+		}
+	}
+	return removed
+}
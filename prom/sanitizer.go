@@ -0,0 +1,60 @@
+package prom
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrNameCollision is returned when different names become the same metric or label name after sanitization
+var ErrNameCollision = errors.New("names collide after sanitization")
+
+var invalidMetricNameCharacters = regexp.MustCompile(`[^a-zA-Z0-9_:]+`)
+var invalidLabelNameCharacters = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// sanitizeMetricName converts arbitrary string (e.g. sensor type reported by device) into valid metric name
+func sanitizeMetricName(name string) string {
+	return sanitizeName(name, invalidMetricNameCharacters)
+}
+
+// sanitizeLabelName converts arbitrary string into valid label name; names starting with "__" are reserved by Prometheus
+func sanitizeLabelName(name string) string {
+	result := sanitizeName(name, invalidLabelNameCharacters)
+	for strings.HasPrefix(result, "__") {
+		result = result[1:]
+	}
+	return result
+}
+
+// sanitizeName replaces every run of invalid characters with single "_" and prepends "_" to name starting with digit;
+// valid names are returned unchanged
+func sanitizeName(name string, invalidCharacters *regexp.Regexp) string {
+	result := invalidCharacters.ReplaceAllString(name, "_")
+	if result == "" || (result[0] >= '0' && result[0] <= '9') {
+		result = "_" + result
+	}
+	return result
+}
+
+// checkLabelCollisions reports different module labels which would be exported under the same name
+func checkLabelCollisions(labelNames []string) error {
+	seen := make(map[string]string, len(labelNames))
+	for _, name := range labelNames {
+		sanitized := sanitizeLabelName(name)
+		if previous, ok := seen[sanitized]; ok && previous != name {
+			return fmt.Errorf("%w: labels %q and %q are both exported as %s", ErrNameCollision, previous, name, sanitized)
+		}
+		seen[sanitized] = name
+	}
+	return nil
+}
+
+// checkNameCollision reports metric which would be exported under the same name as other metric; has to be called with metrics lock held
+func (metrics *Metrics) checkNameCollision(name string) error {
+	sanitized := metrics.prefixName(name)
+	if previous, ok := metrics.metricNames[sanitized]; ok && previous != name {
+		return fmt.Errorf("%w: metrics %q and %q are both exported as %s", ErrNameCollision, previous, name, sanitized)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package prom
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_sanitizeMetricName(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"valid name", "tasmota_sensor_temperature", "tasmota_sensor_temperature"},
+		{"upper case is kept", "Temperature", "Temperature"},
+		{"colon is kept", "job:requests:rate5m", "job:requests:rate5m"},
+		{"dot", "pm2.5", "pm2_5"},
+		{"dash", "sensor-temperature", "sensor_temperature"},
+		{"space", "apparent power", "apparent_power"},
+		{"run of invalid characters", "PM2.5 µg/m³", "PM2_5_g_m_"},
+		{"leading digit", "2nd_sensor", "_2nd_sensor"},
+		{"valid underscores are kept", "a__b", "a__b"},
+		{"empty", "", "_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeMetricName(tt.input); got != tt.want {
+				t.Errorf("sanitizeMetricName(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sanitizeLabelName(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"valid name", "sensor_name", "sensor_name"},
+		{"colon", "ap:index", "ap_index"},
+		{"dot", "sensor.name", "sensor_name"},
+		{"dash and space", "sensor - name", "sensor_name"},
+		{"leading digit", "1st", "_1st"},
+		{"reserved prefix", "__name__", "_name__"},
+		{"reserved prefix after replacement", ".-_name", "_name"},
+		{"empty", "", "_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeLabelName(tt.input); got != tt.want {
+				t.Errorf("sanitizeLabelName(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_checkLabelCollisions(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  []string
+		wantErr bool
+	}{
+		{"no labels", []string{}, false},
+		{"valid labels", []string{"ssid", "bssid"}, false},
+		{"repeated label", []string{"ssid", "ssid"}, false},
+		{"sanitized labels", []string{"sensor-name", "ap.index"}, false},
+		{"collision", []string{"sensor-name", "sensor.name"}, true},
+		{"collision with valid label", []string{"sensor_name", "sensor name"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkLabelCollisions(tt.labels)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrNameCollision)) {
+				t.Errorf("checkLabelCollisions(%v) = %v, wantErr %v", tt.labels, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMetrics_GaugeSet_sanitizedLabels(t *testing.T) {
+	//given
+	metrics := NewMetrics("prefix", TestNamingService{}, 0, Options{})
+	metrics.RegisterGauge(firstInputMetricsKey, "tasmota_sensor_pm2.5", inputMetricsDescription, []string{"ap-index"})
+
+	//when
+	metrics.GaugeSet(firstInputMetricsKey, inputDeviceName, map[string]string{"ap-index": "1"}, 10)
+
+	//then
+	if count := countGathered(t, metrics.registry, "prefix_tasmota_sensor_pm2_5"); count != 1 {
+		t.Fatalf("expected sanitized metric to be exported, got %d series", count)
+	}
+	gauge := metrics.gauges[firstInputMetricsKey]
+	if labels := gauge.labels; labels[len(labels)-1] != "ap_index" {
+		t.Errorf("RegisterGauge() => labels = %v, expected sanitized ap_index label", labels)
+	}
+	if value := testutil.ToFloat64(gauge.metric.WithLabelValues(expectedDeviceName, expectedDeviceGroup, expectedDeviceFName, "1")); value != 10 {
+		t.Errorf("GaugeSet() => value under sanitized label = %v, want %v", value, 10)
+	}
+}
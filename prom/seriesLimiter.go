@@ -0,0 +1,132 @@
+package prom
+
+import (
+	"sync"
+
+	"github.com/klaper_/mqtt_data_exporter/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const SeriesLimitDroppedCount = "series_limit_dropped_total"
+
+// OtherLabelValue replaces every label value of series aggregated over the limit
+const OtherLabelValue = "other"
+
+type SeriesLimitAction string
+
+const (
+	// DropSeries drops writes of new series over the limit
+	DropSeries SeriesLimitAction = "drop"
+	// AggregateSeries writes new series over the limit into single series with all labels set to "other"
+	AggregateSeries SeriesLimitAction = "other"
+)
+
+// SeriesLimits bounds number of series, so misbehaving device (e.g. publishing random topics) can not exhaust memory; 0 = unlimited
+type SeriesLimits struct {
+	Global    int
+	PerMetric int
+	// Metrics override PerMetric limit by metric key
+	Metrics map[string]int
+	Action  SeriesLimitAction
+}
+
+func (limits SeriesLimits) enabled() bool {
+	return limits.Global > 0 || limits.PerMetric > 0 || len(limits.Metrics) > 0
+}
+
+func (limits SeriesLimits) limitOf(key string) int {
+	if limit, ok := limits.Metrics[key]; ok {
+		return limit
+	}
+	return limits.PerMetric
+}
+
+// seriesLimiter remembers series of every metric; series removed by cleaner or retired devices do not count to the limit
+type seriesLimiter struct {
+	limits  SeriesLimits
+	lock    sync.Mutex
+	series  map[string]map[string]bool
+	total   int
+	dropped *prometheus.CounterVec
+}
+
+func newSeriesLimiter(limits SeriesLimits, droppedCounterName string) *seriesLimiter {
+	return &seriesLimiter{
+		limits: limits,
+		series: make(map[string]map[string]bool),
+		dropped: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: droppedCounterName,
+				Help: "Count of writes of new series over series limit (dropped or aggregated into \"other\" series)",
+			}, []string{"key"}),
+	}
+}
+
+// admit checks whether series can be written; returns label values to be written,
+// which are replaced with "other" when series over the limit is aggregated
+func (limiter *seriesLimiter) admit(kind string, key string, labelNames []string, labelValues []string) ([]string, bool) {
+	if !limiter.limits.enabled() {
+		return labelValues, true
+	}
+	id := cleanerKey(kind, key)
+	hash := calculateHash(id, seriesLabels(labelNames, labelValues))
+
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	known := limiter.series[id]
+	if known[hash] {
+		return labelValues, true
+	}
+	limit := limiter.limits.limitOf(key)
+	if (limit == 0 || len(known) < limit) && (limiter.limits.Global == 0 || limiter.total < limiter.limits.Global) {
+		if known == nil {
+			known = make(map[string]bool)
+			limiter.series[id] = known
+		}
+		known[hash] = true
+		limiter.total++
+		return labelValues, true
+	}
+
+	limiter.dropped.WithLabelValues(key).Inc()
+	logger.Debug("series_limiter", "Series limit of %s exceeded by %v", key, labelValues)
+	if limiter.limits.Action != AggregateSeries {
+		return nil, false
+	}
+	other := make([]string, len(labelValues))
+	for i := range other {
+		other[i] = OtherLabelValue
+	}
+	return other, true
+}
+
+func (limiter *seriesLimiter) forget(kind string, key string, labels prometheus.Labels) {
+	if !limiter.limits.enabled() {
+		return
+	}
+	id := cleanerKey(kind, key)
+	hash := calculateHash(id, labels)
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	if known := limiter.series[id]; known[hash] {
+		delete(known, hash)
+		limiter.total--
+	}
+}
+
+// tracked wraps vector, so series deleted from it are forgotten by limiter
+func (limiter *seriesLimiter) tracked(kind string, key string, vector gaugeVector) gaugeVector {
+	return &trackedVector{gaugeVector: vector, forget: func(labels prometheus.Labels) {
+		limiter.forget(kind, key, labels)
+	}}
+}
+
+type trackedVector struct {
+	gaugeVector
+	forget func(labels prometheus.Labels)
+}
+
+func (vector *trackedVector) Delete(labels prometheus.Labels) bool {
+	vector.forget(labels)
+	return vector.gaugeVector.Delete(labels)
+}
@@ -0,0 +1,92 @@
+package prom
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics_seriesLimits(t *testing.T) {
+	tests := []struct {
+		name          string
+		limits        SeriesLimits
+		firstDevices  []string
+		secondDevices []string
+		wantFirst     int
+		wantSecond    int
+		wantDropped   float64
+	}{
+		{"unlimited", SeriesLimits{}, []string{"a", "b", "c"}, []string{"a"}, 3, 1, 0},
+		{"per metric limit", SeriesLimits{PerMetric: 2}, []string{"a", "b", "c", "d"}, []string{"a", "b"}, 2, 2, 2},
+		{"existing series are written", SeriesLimits{PerMetric: 2}, []string{"a", "b", "a", "b"}, []string{}, 2, 0, 0},
+		{"metric limit overrides per metric limit", SeriesLimits{PerMetric: 2, Metrics: map[string]int{"first": 3}}, []string{"a", "b", "c", "d"}, []string{"a", "b", "c"}, 3, 2, 2},
+		{"global limit", SeriesLimits{Global: 3}, []string{"a", "b"}, []string{"a", "b"}, 2, 1, 1},
+		{"aggregated into other", SeriesLimits{PerMetric: 1, Action: AggregateSeries}, []string{"a", "b", "c"}, []string{"a"}, 2, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//given
+			metrics := NewMetrics("", TestNamingService{}, 0, Options{SeriesLimits: tt.limits})
+			metrics.RegisterCounter("first", "TestMetrics_seriesLimits_first", inputMetricsDescription, []string{})
+			metrics.RegisterGauge("second", "TestMetrics_seriesLimits_second", inputMetricsDescription, []string{})
+
+			//when
+			for _, device := range tt.firstDevices {
+				metrics.CounterInc("first", device, map[string]string{})
+			}
+			for _, device := range tt.secondDevices {
+				metrics.GaugeSet("second", device, map[string]string{}, 1)
+			}
+
+			//then
+			if count := countSeries(metrics.counters["first"].metric); count != tt.wantFirst {
+				t.Errorf("first metric has %d series, want %d", count, tt.wantFirst)
+			}
+			if count := countSeries(metrics.gauges["second"].metric); count != tt.wantSecond {
+				t.Errorf("second metric has %d series, want %d", count, tt.wantSecond)
+			}
+			dropped := testutil.ToFloat64(metrics.seriesLimiter.dropped.WithLabelValues("first")) + testutil.ToFloat64(metrics.seriesLimiter.dropped.WithLabelValues("second"))
+			if dropped != tt.wantDropped {
+				t.Errorf("dropped writes = %v, want %v", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestMetrics_seriesLimits_aggregated(t *testing.T) {
+	//given
+	metrics := NewMetrics("", TestNamingService{}, 0, Options{SeriesLimits: SeriesLimits{PerMetric: 1, Action: AggregateSeries}})
+	metrics.RegisterCounter(firstInputMetricsKey, firstInputMetricsName, inputMetricsDescription, []string{"code"})
+
+	//when
+	metrics.CounterInc(firstInputMetricsKey, "a", map[string]string{"code": "1"})
+	metrics.CounterInc(firstInputMetricsKey, "b", map[string]string{"code": "2"})
+	metrics.CounterInc(firstInputMetricsKey, "c", map[string]string{"code": "3"})
+
+	//then
+	other := metrics.counters[firstInputMetricsKey].metric.WithLabelValues(OtherLabelValue, OtherLabelValue, OtherLabelValue, OtherLabelValue)
+	if value := testutil.ToFloat64(other); value != 2 {
+		t.Errorf("other series = %v, want %v", value, 2)
+	}
+}
+
+func TestMetrics_seriesLimits_removedSeries(t *testing.T) {
+	//given
+	metrics := NewMetrics("", TestNamingService{}, 0, Options{SeriesLimits: SeriesLimits{PerMetric: 2}})
+	metrics.RegisterGauge(firstInputMetricsKey, firstInputMetricsName, inputMetricsDescription, []string{})
+	metrics.GaugeSet(firstInputMetricsKey, "a", map[string]string{}, 1)
+	metrics.GaugeSet(firstInputMetricsKey, "b", map[string]string{}, 1)
+
+	//when
+	metrics.RetireDevices([]string{"a"})
+	metrics.GaugeSet(firstInputMetricsKey, "c", map[string]string{}, 1)
+	metrics.GaugeSet(firstInputMetricsKey, "d", map[string]string{}, 1)
+
+	//then
+	if count := countSeries(metrics.gauges[firstInputMetricsKey].metric); count != 2 {
+		t.Errorf("metric has %d series, want %d", count, 2)
+	}
+	if value := testutil.ToFloat64(metrics.gauges[firstInputMetricsKey].metric.WithLabelValues("c", "", "c")); value != 1 {
+		t.Errorf("series of new device should replace retired one")
+	}
+}
@@ -0,0 +1,48 @@
+package prom
+
+import (
+	"time"
+
+	"github.com/klaper_/mqtt_data_exporter/backend"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var _ backend.Store = (*Metrics)(nil)
+
+// AddSink forwards every gauge and counter write to sink besides exporting it
+func (metrics *Metrics) AddSink(sink backend.Sink) {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	metrics.sinks = append(metrics.sinks, sink)
+}
+
+// toSinks sends value of series read back from written metric, so counters are sent as totals;
+// samples without timestamp get the current time, as sinks may send them much later
+func (metrics *Metrics) toSinks(kind backend.Kind, name string, deviceName string, series map[string]string, metric prometheus.Metric, timestamp time.Time) {
+	metrics.lock.RLock()
+	sinks := metrics.sinks
+	metrics.lock.RUnlock()
+	if len(sinks) == 0 {
+		return
+	}
+	written := &dto.Metric{}
+	if err := metric.Write(written); err != nil {
+		return
+	}
+	value := written.GetGauge().GetValue()
+	if kind == backend.Counter {
+		value = written.GetCounter().GetValue()
+	}
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	labels := make(map[string]string, len(series))
+	for name, labelValue := range series {
+		labels[name] = labelValue
+	}
+	sample := backend.Sample{Name: name, Kind: kind, Device: deviceName, Labels: labels, Properties: metrics.appendRestrictedToValues(deviceName, nil), Value: value, Timestamp: timestamp}
+	for _, sink := range sinks {
+		sink.Write(sample)
+	}
+}
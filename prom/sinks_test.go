@@ -0,0 +1,127 @@
+package prom
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klaper_/mqtt_data_exporter/backend"
+)
+
+type recordingSink struct {
+	lock    sync.Mutex
+	samples []backend.Sample
+}
+
+func (sink *recordingSink) Write(sample backend.Sample) {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	sink.samples = append(sink.samples, sample)
+}
+
+func TestMetrics_AddSink(t *testing.T) {
+	deviceTime := time.Unix(1600000000, 0)
+	deviceLabels := map[string]string{"device": "deviceName", "friendly_name": "deviceFName", "group": "deviceGroup"}
+	tests := []struct {
+		name             string
+		deviceTimestamps bool
+		write            func(metrics *Metrics)
+		want             []backend.Sample
+		wantTimestamp    time.Time
+	}{
+		{
+			name:  "gauge set",
+			write: func(metrics *Metrics) { metrics.GaugeSet("gauge", inputDeviceName, map[string]string{}, 21.5) },
+			want:  []backend.Sample{{Name: "sink_temperature", Kind: backend.Gauge, Device: inputDeviceName, Labels: deviceLabels, Properties: deviceLabels, Value: 21.5}},
+		},
+		{
+			name: "gauge add sends current value",
+			write: func(metrics *Metrics) {
+				metrics.GaugeSet("gauge", inputDeviceName, map[string]string{}, 2)
+				metrics.GaugeAdd("gauge", inputDeviceName, map[string]string{}, -0.5)
+			},
+			want: []backend.Sample{
+				{Name: "sink_temperature", Kind: backend.Gauge, Device: inputDeviceName, Labels: deviceLabels, Properties: deviceLabels, Value: 2},
+				{Name: "sink_temperature", Kind: backend.Gauge, Device: inputDeviceName, Labels: deviceLabels, Properties: deviceLabels, Value: 1.5},
+			},
+		},
+		{
+			name: "counter sends total",
+			write: func(metrics *Metrics) {
+				metrics.CounterInc("counter", inputDeviceName, map[string]string{})
+				metrics.CounterAdd("counter", inputDeviceName, map[string]string{}, 2)
+			},
+			want: []backend.Sample{
+				{Name: "sink_messages", Kind: backend.Counter, Device: inputDeviceName, Labels: deviceLabels, Properties: deviceLabels, Value: 1},
+				{Name: "sink_messages", Kind: backend.Counter, Device: inputDeviceName, Labels: deviceLabels, Properties: deviceLabels, Value: 3},
+			},
+		},
+		{
+			name:             "device timestamp",
+			deviceTimestamps: true,
+			write: func(metrics *Metrics) {
+				metrics.GaugeSetWithTimestamp("gauge", inputDeviceName, map[string]string{}, 20, deviceTime)
+			},
+			want:          []backend.Sample{{Name: "sink_temperature", Kind: backend.Gauge, Device: inputDeviceName, Labels: deviceLabels, Properties: deviceLabels, Value: 20}},
+			wantTimestamp: deviceTime,
+		},
+		{
+			name:  "negative counter delta is not sent",
+			write: func(metrics *Metrics) { metrics.CounterAdd("counter", inputDeviceName, map[string]string{}, -1) },
+			want:  nil,
+		},
+		{
+			name:  "unregistered metric is not sent",
+			write: func(metrics *Metrics) { metrics.GaugeSet("unknown", inputDeviceName, map[string]string{}, 1) },
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//given
+			metrics := NewMetrics("sink", TestNamingService{}, 0, Options{DeviceTimestamps: tt.deviceTimestamps})
+			metrics.RegisterGauge("gauge", "temperature", inputMetricsDescription, []string{})
+			metrics.RegisterCounter("counter", "messages", inputMetricsDescription, []string{})
+			sink := &recordingSink{}
+			metrics.AddSink(sink)
+			before := time.Now()
+
+			//when
+			tt.write(metrics)
+
+			//then
+			if len(sink.samples) != len(tt.want) {
+				t.Fatalf("sink got %d samples, want %d: %+v", len(sink.samples), len(tt.want), sink.samples)
+			}
+			for i, sample := range sink.samples {
+				if tt.wantTimestamp.IsZero() && sample.Timestamp.Before(before) || !tt.wantTimestamp.IsZero() && !sample.Timestamp.Equal(tt.wantTimestamp) {
+					t.Errorf("sample %d timestamp = %v, want %v", i, sample.Timestamp, tt.wantTimestamp)
+				}
+				sample.Timestamp = time.Time{}
+				if !reflect.DeepEqual(sample, tt.want[i]) {
+					t.Errorf("sample %d = %+v, want %+v", i, sample, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMetrics_AddSink_deviceInfo(t *testing.T) {
+	//given
+	metrics := NewMetrics("sink", TestNamingService{}, 0, Options{DeviceInfo: true})
+	metrics.RegisterGauge("gauge", "temperature", inputMetricsDescription, []string{})
+	sink := &recordingSink{}
+	metrics.AddSink(sink)
+
+	//when
+	metrics.GaugeSet("gauge", inputDeviceName, map[string]string{}, 1)
+
+	//then
+	if len(sink.samples) != 1 || !reflect.DeepEqual(sink.samples[0].Labels, map[string]string{"device": "deviceName"}) {
+		t.Fatalf("sink got %+v, want sample with device label only", sink.samples)
+	}
+	if properties := sink.samples[0].Properties; properties["friendly_name"] != "deviceFName" || properties["group"] != "deviceGroup" {
+		t.Errorf("sink got properties %v, want device properties", properties)
+	}
+}
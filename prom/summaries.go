@@ -0,0 +1,22 @@
+package prom
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// RegisterSummary registers summary with given quantile objectives (quantile: allowed error);
+// summary without objectives exposes only count and sum of observations
+func (metrics *Metrics) RegisterSummary(key string, name string, description string, labelNames []string, objectives map[float64]float64) error {
+	labels := metrics.prepareLabelNames(labelNames)
+	return metrics.registerObserver(metrics.summaries, summaryKind, key, name, labelNames, labels, func() observerVector {
+		return prometheus.NewSummaryVec(
+			prometheus.SummaryOpts{
+				Name:       metrics.prefixName(name),
+				Help:       description,
+				Objectives: objectives,
+			}, labels)
+	})
+}
+
+// SummaryObserve adds observation (e.g. sensor read interval) to summary
+func (metrics *Metrics) SummaryObserve(key string, deviceName string, labels map[string]string, value float64) {
+	metrics.observe(metrics.summaries, summaryKind, key, deviceName, labels, value)
+}
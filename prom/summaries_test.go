@@ -0,0 +1,58 @@
+package prom
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics_RegisterSummary(t *testing.T) {
+	//given
+	metrics := NewMetrics("", nil, 0, Options{})
+	metrics.RegisterSummary(firstInputMetricsKey, firstInputMetricsName, inputMetricsDescription, inputLabelNames, nil)
+
+	//when
+	exists := metrics.RegisterSummary(firstInputMetricsKey, "TestMetrics_RegisterSummary_exists", inputMetricsDescription, inputLabelNames, nil)
+	added := metrics.RegisterSummary(secondInputMetricsKey, secondInputMetricsName, inputMetricsDescription, inputLabelNames, map[float64]float64{0.5: 0.05})
+	reserved := metrics.RegisterSummary("reserved", "TestMetrics_RegisterSummary_reserved", inputMetricsDescription, []string{"quantile"}, nil)
+
+	//then
+	if !errors.Is(exists, ErrKeyRegistered) {
+		t.Errorf("RegisterSummary() = %v for existing key, want %v", exists, ErrKeyRegistered)
+	}
+	if added != nil {
+		t.Errorf("RegisterSummary() = %v for new key, want %v", added, nil)
+	}
+	if reserved == nil {
+		t.Errorf("RegisterSummary() = %v for quantile label, want error", reserved)
+	}
+}
+
+func TestMetrics_SummaryObserve(t *testing.T) {
+	//given
+	metrics := NewMetrics("prefix", TestNamingService{}, 0, Options{})
+	metrics.RegisterSummary("power", "power_watts", "Power draw", []string{}, map[float64]float64{0.5: 0.05})
+
+	//when
+	for _, value := range []float64{10, 20, 30} {
+		metrics.SummaryObserve("power", inputDeviceName, map[string]string{}, value)
+	}
+	metrics.SummaryObserve("power", "otherDevice", map[string]string{}, 5)
+
+	//then
+	expected := `
+# HELP prefix_power_watts Power draw
+# TYPE prefix_power_watts summary
+prefix_power_watts{device="deviceName",friendly_name="deviceFName",group="deviceGroup",quantile="0.5"} 20
+prefix_power_watts_sum{device="deviceName",friendly_name="deviceFName",group="deviceGroup"} 60
+prefix_power_watts_count{device="deviceName",friendly_name="deviceFName",group="deviceGroup"} 3
+prefix_power_watts{device="otherDevice",friendly_name="otherDevice",group="",quantile="0.5"} 5
+prefix_power_watts_sum{device="otherDevice",friendly_name="otherDevice",group=""} 5
+prefix_power_watts_count{device="otherDevice",friendly_name="otherDevice",group=""} 1
+`
+	if err := testutil.CollectAndCompare(metrics.summaries["power"].metric, strings.NewReader(expected), "prefix_power_watts"); err != nil {
+		t.Errorf("SummaryObserve() unexpected result: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package prom
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// timestampedGaugeVec exposes samples with explicit timestamps (e.g. reported by device) when one was provided
+type timestampedGaugeVec struct {
+	*prometheus.GaugeVec
+	labelNames []string
+	lock       sync.RWMutex
+	timestamps map[string]time.Time
+}
+
+func newTimestampedGaugeVec(vec *prometheus.GaugeVec, labelNames []string) *timestampedGaugeVec {
+	sorted := append([]string{}, labelNames...)
+	sort.Strings(sorted)
+	return &timestampedGaugeVec{
+		GaugeVec:   vec,
+		labelNames: sorted,
+		timestamps: make(map[string]time.Time),
+	}
+}
+
+// Set updates the value and drops timestamp of the series, so it is exposed with scrape time again
+func (vec *timestampedGaugeVec) Set(labels map[string]string, labelValues []string, value float64) prometheus.Gauge {
+	vec.lock.Lock()
+	defer vec.lock.Unlock()
+	gauge := vec.GaugeVec.WithLabelValues(labelValues...)
+	gauge.Set(value)
+	delete(vec.timestamps, vec.timestampKey(labels))
+	return gauge
+}
+
+// Add changes the value by delta and drops timestamp of the series, like Set
+func (vec *timestampedGaugeVec) Add(labels map[string]string, labelValues []string, delta float64) prometheus.Gauge {
+	vec.lock.Lock()
+	defer vec.lock.Unlock()
+	gauge := vec.GaugeVec.WithLabelValues(labelValues...)
+	gauge.Add(delta)
+	delete(vec.timestamps, vec.timestampKey(labels))
+	return gauge
+}
+
+func (vec *timestampedGaugeVec) SetWithTimestamp(labels map[string]string, labelValues []string, value float64, timestamp time.Time) prometheus.Gauge {
+	vec.lock.Lock()
+	defer vec.lock.Unlock()
+	gauge := vec.GaugeVec.WithLabelValues(labelValues...)
+	gauge.Set(value)
+	vec.timestamps[vec.timestampKey(labels)] = timestamp
+	return gauge
+}
+
+func (vec *timestampedGaugeVec) Delete(labels prometheus.Labels) bool {
+	vec.lock.Lock()
+	defer vec.lock.Unlock()
+	delete(vec.timestamps, vec.timestampKey(labels))
+	return vec.GaugeVec.Delete(labels)
+}
+
+func (vec *timestampedGaugeVec) Collect(ch chan<- prometheus.Metric) {
+	vec.lock.RLock()
+	defer vec.lock.RUnlock()
+	if len(vec.timestamps) == 0 {
+		vec.GaugeVec.Collect(ch)
+		return
+	}
+
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		vec.GaugeVec.Collect(metrics)
+		close(metrics)
+	}()
+	for metric := range metrics {
+		ch <- vec.withTimestamp(metric)
+	}
+}
+
+func (vec *timestampedGaugeVec) withTimestamp(metric prometheus.Metric) prometheus.Metric {
+	written := &dto.Metric{}
+	if err := metric.Write(written); err != nil {
+		return metric
+	}
+	labels := make(map[string]string, len(written.Label))
+	for _, pair := range written.Label {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	if timestamp, ok := vec.timestamps[vec.timestampKey(labels)]; ok {
+		return prometheus.NewMetricWithTimestamp(timestamp, metric)
+	}
+	return metric
+}
+
+// timestampKey identifies series by values of vector labels only, as labels map may carry more entries
+func (vec *timestampedGaugeVec) timestampKey(labels map[string]string) string {
+	var builder strings.Builder
+	for _, name := range vec.labelNames {
+		builder.WriteString(labels[name])
+		builder.WriteByte(0xff)
+	}
+	return builder.String()
+}
@@ -0,0 +1,104 @@
+package prom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var timestampedLabelNames = []string{"device", "label"}
+
+func collectTimestamps(vec *timestampedGaugeVec) []int64 {
+	ch := make(chan prometheus.Metric, 10)
+	vec.Collect(ch)
+	close(ch)
+	result := make([]int64, 0)
+	for metric := range ch {
+		written := &dto.Metric{}
+		_ = metric.Write(written)
+		result = append(result, written.GetTimestampMs())
+	}
+	return result
+}
+
+func newTestTimestampedGaugeVec() *timestampedGaugeVec {
+	return newTimestampedGaugeVec(
+		prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test"}, timestampedLabelNames),
+		timestampedLabelNames,
+	)
+}
+
+func Test_timestampedGaugeVec_SetWithTimestamp(t *testing.T) {
+	//given
+	vec := newTestTimestampedGaugeVec()
+	timestamp := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	labels := map[string]string{"device": "d1", "label": "l1", "other": "o1"}
+
+	//when
+	vec.SetWithTimestamp(labels, []string{"d1", "l1"}, 1, timestamp)
+
+	//then
+	if result := collectTimestamps(vec); len(result) != 1 || result[0] != timestamp.UnixNano()/int64(time.Millisecond) {
+		t.Errorf("SetWithTimestamp(): expected timestamp %d, got %+v", timestamp.UnixNano()/int64(time.Millisecond), result)
+	}
+}
+
+func Test_timestampedGaugeVec_SetDropsTimestamp(t *testing.T) {
+	//given
+	vec := newTestTimestampedGaugeVec()
+	labels := map[string]string{"device": "d1", "label": "l1"}
+	vec.SetWithTimestamp(labels, []string{"d1", "l1"}, 1, time.Now())
+
+	//when
+	vec.Set(labels, []string{"d1", "l1"}, 2)
+
+	//then
+	if result := collectTimestamps(vec); len(result) != 1 || result[0] != 0 {
+		t.Errorf("Set(): expected no timestamp, got %+v", result)
+	}
+}
+
+func Test_timestampedGaugeVec_Delete(t *testing.T) {
+	//given
+	vec := newTestTimestampedGaugeVec()
+	labels := map[string]string{"device": "d1", "label": "l1"}
+	vec.SetWithTimestamp(labels, []string{"d1", "l1"}, 1, time.Now())
+
+	//when
+	vec.Delete(labels)
+
+	//then
+	if len(vec.timestamps) != 0 || len(collectTimestamps(vec)) != 0 {
+		t.Errorf("Delete(): expected series and timestamp to be removed")
+	}
+}
+
+func TestMetrics_GaugeSetWithTimestamp_disabled(t *testing.T) {
+	//given
+	metrics := NewMetrics("", TestNamingService{}, 0, Options{})
+	metrics.RegisterGauge(firstInputMetricsKey, "TestMetrics_GaugeSetWithTimestamp_disabled", inputMetricsDescription, inputLabelNames)
+
+	//when
+	metrics.GaugeSetWithTimestamp(firstInputMetricsKey, inputDeviceName, map[string]string{}, 1, time.Now())
+
+	//then
+	if len(metrics.gauges[firstInputMetricsKey].metric.timestamps) != 0 {
+		t.Errorf("GaugeSetWithTimestamp(): timestamp should not be stored when device timestamps are disabled")
+	}
+}
+
+func TestMetrics_GaugeSetWithTimestamp_enabled(t *testing.T) {
+	//given
+	metrics := NewMetrics("", TestNamingService{}, 0, Options{DeviceTimestamps: true})
+	metrics.RegisterGauge(firstInputMetricsKey, "TestMetrics_GaugeSetWithTimestamp_enabled", inputMetricsDescription, inputLabelNames)
+
+	//when
+	metrics.GaugeSetWithTimestamp(firstInputMetricsKey, inputDeviceName, map[string]string{}, 1, time.Now())
+
+	//then
+	if len(metrics.gauges[firstInputMetricsKey].metric.timestamps) != 1 {
+		t.Errorf("GaugeSetWithTimestamp(): timestamp should be stored when device timestamps are enabled")
+	}
+}
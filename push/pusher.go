@@ -0,0 +1,251 @@
+package push
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/klaper_/mqtt_data_exporter/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const moduleId = "push"
+
+const (
+	BatchesCount    = "push_batches_total"
+	BufferedBatches = "push_buffered_batches"
+)
+
+type Protocol string
+
+const (
+	Pushgateway Protocol = "pushgateway"
+	RemoteWrite Protocol = "remote-write"
+)
+
+type Config struct {
+	URL      string
+	Protocol Protocol
+	// Job is grouping key of pushgateway and job label of remote-write series
+	Job        string
+	Interval   time.Duration
+	Timeout    time.Duration
+	BufferSize int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// target encodes gathered metrics and builds requests of single push protocol
+type target interface {
+	encode(families []*dto.MetricFamily, now time.Time) ([]byte, error)
+	newRequest(body []byte) (*http.Request, error)
+	// buffered tells whether unsent batches are worth sending later; otherwise only the latest one is kept
+	buffered() bool
+}
+
+// statusError is returned for rejected requests; client errors (but 429) are not retried, as the same batch would be rejected again
+type statusError struct {
+	status string
+	code   int
+}
+
+func (err statusError) Error() string {
+	return fmt.Sprintf("unexpected status %s", err.status)
+}
+
+func (err statusError) retryable() bool {
+	return err.code == http.StatusTooManyRequests || err.code >= http.StatusInternalServerError
+}
+
+// Pusher periodically pushes gathered metrics; batches which could not be sent are buffered and retried with backoff
+type Pusher struct {
+	config   Config
+	target   target
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	now      func() time.Time
+
+	lock     sync.Mutex
+	buffer   [][]byte
+	failures int
+	stop     chan struct{}
+
+	batchesCounter  *prometheus.CounterVec
+	bufferedBatches prometheus.Gauge
+}
+
+func NewPusher(config Config, gatherer prometheus.Gatherer, registerer prometheus.Registerer, metricsPrefix string) (*Pusher, error) {
+	var pushTarget target
+	switch config.Protocol {
+	case Pushgateway:
+		pushTarget = &pushgatewayTarget{url: config.URL, job: config.Job}
+	case RemoteWrite:
+		pushTarget = &remoteWriteTarget{url: config.URL, job: config.Job}
+	default:
+		return nil, fmt.Errorf("unknown push protocol %q", config.Protocol)
+	}
+	if config.Interval <= 0 || config.Timeout <= 0 || config.MaxBackoff <= 0 {
+		return nil, fmt.Errorf("push interval, timeout and max backoff have to be positive, got %v, %v and %v", config.Interval, config.Timeout, config.MaxBackoff)
+	}
+	if config.BufferSize < 1 || !pushTarget.buffered() {
+		config.BufferSize = 1
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = time.Second
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = config.MinBackoff
+	}
+	pusher := &Pusher{
+		config:   config,
+		target:   pushTarget,
+		gatherer: gatherer,
+		client:   &http.Client{Timeout: config.Timeout},
+		now:      time.Now,
+		stop:     make(chan struct{}),
+		batchesCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: metricsPrefix + "_" + BatchesCount,
+				Help: "Count of pushed batches by result: sent, failed (to be retried), rejected or dropped (buffer full)",
+			}, []string{"result"}),
+		bufferedBatches: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: metricsPrefix + "_" + BufferedBatches,
+				Help: "Number of batches waiting to be pushed",
+			}),
+	}
+	for _, collector := range []prometheus.Collector{pusher.batchesCounter, pusher.bufferedBatches} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return pusher, nil
+}
+
+// Run pushes metrics every interval until Stop is called
+func (pusher *Pusher) Run() {
+	ticker := time.NewTicker(pusher.config.Interval)
+	go func() {
+		defer ticker.Stop()
+		pusher.run(ticker.C)
+	}()
+}
+
+func (pusher *Pusher) Stop() {
+	close(pusher.stop)
+}
+
+func (pusher *Pusher) run(ticks <-chan time.Time) {
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-pusher.stop:
+			return
+		case <-ticks:
+			pusher.collect()
+			if retry != nil {
+				// buffered batches are sent after backoff
+				continue
+			}
+		case <-retry:
+		}
+		retry = nil
+		if err := pusher.flush(); err != nil {
+			backoff := pusher.backoff()
+			logger.Warn(moduleId, "Could not push metrics to %s, retrying in %v: %v", pusher.config.URL, backoff, err)
+			retry = time.After(backoff)
+		}
+	}
+}
+
+// collect gathers metrics into buffer; when buffer is full the oldest batch is dropped
+func (pusher *Pusher) collect() {
+	families, err := pusher.gatherer.Gather()
+	if err != nil {
+		// partial result is still pushed, the same way it is still served when scraped
+		logger.Warn(moduleId, "Error gathering metrics: %v", err)
+	}
+	batch, err := pusher.target.encode(families, pusher.now())
+	if err != nil {
+		logger.Warn(moduleId, "Could not encode metrics: %v", err)
+		return
+	}
+
+	pusher.lock.Lock()
+	defer pusher.lock.Unlock()
+	if len(pusher.buffer) >= pusher.config.BufferSize {
+		if pusher.target.buffered() {
+			pusher.batchesCounter.WithLabelValues("dropped").Inc()
+		}
+		pusher.buffer = pusher.buffer[1:]
+	}
+	pusher.buffer = append(pusher.buffer, batch)
+	pusher.bufferedBatches.Set(float64(len(pusher.buffer)))
+}
+
+// flush sends buffered batches oldest first; it stops at first failure which is worth retrying
+func (pusher *Pusher) flush() error {
+	pusher.lock.Lock()
+	defer pusher.lock.Unlock()
+	defer func() { pusher.bufferedBatches.Set(float64(len(pusher.buffer))) }()
+	for len(pusher.buffer) > 0 {
+		err := pusher.send(pusher.buffer[0])
+		if statusErr, ok := err.(statusError); ok && !statusErr.retryable() {
+			logger.Warn(moduleId, "Metrics rejected by %s, dropping batch: %v", pusher.config.URL, err)
+			pusher.batchesCounter.WithLabelValues("rejected").Inc()
+		} else if err != nil {
+			pusher.failures++
+			pusher.batchesCounter.WithLabelValues("failed").Inc()
+			return err
+		} else {
+			pusher.batchesCounter.WithLabelValues("sent").Inc()
+		}
+		pusher.failures = 0
+		pusher.buffer = pusher.buffer[1:]
+	}
+	return nil
+}
+
+func (pusher *Pusher) send(batch []byte) error {
+	request, err := pusher.target.newRequest(batch)
+	if err != nil {
+		return err
+	}
+	response, err := pusher.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return statusError{status: response.Status, code: response.StatusCode}
+	}
+	return nil
+}
+
+// backoff doubles with every consecutive failure, from MinBackoff up to MaxBackoff
+func (pusher *Pusher) backoff() time.Duration {
+	pusher.lock.Lock()
+	defer pusher.lock.Unlock()
+	backoff := pusher.config.MinBackoff
+	for i := 1; i < pusher.failures && backoff < pusher.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > pusher.config.MaxBackoff {
+		return pusher.config.MaxBackoff
+	}
+	return backoff
+}
+
+func newRequest(method string, url string, body []byte, headers map[string]string) (*http.Request, error) {
+	request, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	return request, nil
+}
@@ -0,0 +1,225 @@
+package push
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testReceiver answers pushes with queued statuses (200 when queue is empty) and records accepted bodies
+type testReceiver struct {
+	lock     sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (receiver *testReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	status := http.StatusOK
+	if len(receiver.statuses) > 0 {
+		status, receiver.statuses = receiver.statuses[0], receiver.statuses[1:]
+	}
+	if status == http.StatusOK {
+		receiver.requests = append(receiver.requests, r)
+		receiver.bodies = append(receiver.bodies, body)
+	}
+	w.WriteHeader(status)
+}
+
+func (receiver *testReceiver) received() [][]byte {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	return append([][]byte{}, receiver.bodies...)
+}
+
+func newTestPusher(t *testing.T, protocol Protocol, url string, bufferSize int) (*Pusher, prometheus.Gauge, *prometheus.Registry) {
+	gatherer := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test gauge"})
+	gatherer.MustRegister(gauge)
+	registerer := prometheus.NewRegistry()
+	pusher, err := NewPusher(Config{URL: url, Protocol: protocol, Job: "test", Interval: time.Minute, Timeout: time.Second, BufferSize: bufferSize, MinBackoff: time.Second, MaxBackoff: 10 * time.Second}, gatherer, registerer, "test")
+	if err != nil {
+		t.Fatalf("NewPusher() error = %v", err)
+	}
+	pusher.now = func() time.Time { return time.Unix(1000, 0) }
+	return pusher, gauge, registerer
+}
+
+func TestPusher_flush(t *testing.T) {
+	tests := []struct {
+		name         string
+		protocol     Protocol
+		bufferSize   int
+		statuses     []int
+		collects     []float64
+		wantErr      bool
+		wantValues   []float64
+		wantBuffered int
+		wantResults  map[string]float64
+	}{
+		{"sent", RemoteWrite, 10, nil, []float64{1}, false, []float64{1}, 0, map[string]float64{"sent": 1}},
+		{"buffered batches are sent in order", RemoteWrite, 10, nil, []float64{1, 2, 3}, false, []float64{1, 2, 3}, 0, map[string]float64{"sent": 3}},
+		{"server error is retried", RemoteWrite, 10, []int{http.StatusServiceUnavailable}, []float64{1, 2}, true, nil, 2, map[string]float64{"failed": 1}},
+		{"too many requests is retried", RemoteWrite, 10, []int{http.StatusTooManyRequests}, []float64{1}, true, nil, 1, map[string]float64{"failed": 1}},
+		{"client error is not retried", RemoteWrite, 10, []int{http.StatusBadRequest}, []float64{1, 2}, false, []float64{2}, 0, map[string]float64{"rejected": 1, "sent": 1}},
+		{"oldest batch is dropped when buffer is full", RemoteWrite, 2, nil, []float64{1, 2, 3}, false, []float64{2, 3}, 0, map[string]float64{"dropped": 1, "sent": 2}},
+		{"pushgateway keeps only latest batch", Pushgateway, 10, nil, []float64{1, 2, 3}, false, []float64{3}, 0, map[string]float64{"sent": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//given
+			receiver := &testReceiver{statuses: tt.statuses}
+			server := httptest.NewServer(receiver)
+			defer server.Close()
+			pusher, gauge, registerer := newTestPusher(t, tt.protocol, server.URL, tt.bufferSize)
+			for _, value := range tt.collects {
+				gauge.Set(value)
+				pusher.collect()
+			}
+
+			//when
+			err := pusher.flush()
+
+			//then
+			if (err != nil) != tt.wantErr {
+				t.Errorf("flush() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			bodies := receiver.received()
+			if len(bodies) != len(tt.wantValues) {
+				t.Fatalf("flush() => %d batches received, want %d", len(bodies), len(tt.wantValues))
+			}
+			for i, body := range bodies {
+				if got := receivedGaugeValue(t, tt.protocol, body); got != tt.wantValues[i] {
+					t.Errorf("flush() => batch %d has value %v, want %v", i, got, tt.wantValues[i])
+				}
+			}
+			if got := testutil.ToFloat64(pusher.bufferedBatches); got != float64(tt.wantBuffered) {
+				t.Errorf("flush() => %v batches buffered, want %d", got, tt.wantBuffered)
+			}
+			for result, want := range tt.wantResults {
+				if got := testutil.ToFloat64(pusher.batchesCounter.WithLabelValues(result)); got != want {
+					t.Errorf("flush() => %s batches = %v, want %v", result, got, want)
+				}
+			}
+			if count, _ := testutil.GatherAndCount(registerer, "test_"+BatchesCount); count != len(tt.wantResults) {
+				t.Errorf("flush() => %d results counted, want %d", count, len(tt.wantResults))
+			}
+		})
+	}
+}
+
+func TestPusher_retry(t *testing.T) {
+	//given
+	receiver := &testReceiver{statuses: []int{http.StatusBadGateway}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	pusher, gauge, _ := newTestPusher(t, RemoteWrite, server.URL, 10)
+	gauge.Set(1)
+	pusher.collect()
+	gauge.Set(2)
+	pusher.collect()
+
+	//when
+	firstErr := pusher.flush()
+	secondErr := pusher.flush()
+
+	//then
+	if firstErr == nil || secondErr != nil {
+		t.Errorf("flush() errors = %v, %v; want failure and then success", firstErr, secondErr)
+	}
+	bodies := receiver.received()
+	if len(bodies) != 2 || receivedGaugeValue(t, RemoteWrite, bodies[0]) != 1 || receivedGaugeValue(t, RemoteWrite, bodies[1]) != 2 {
+		t.Errorf("flush() => %d batches received, want both batches in order", len(bodies))
+	}
+}
+
+func TestPusher_backoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		want     time.Duration
+	}{
+		{"first failure", 1, time.Second},
+		{"second failure", 2, 2 * time.Second},
+		{"third failure", 3, 4 * time.Second},
+		{"capped", 10, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pusher, _, _ := newTestPusher(t, RemoteWrite, "http://localhost", 1)
+			pusher.failures = tt.failures
+			if got := pusher.backoff(); got != tt.want {
+				t.Errorf("backoff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPusher_Run(t *testing.T) {
+	//given
+	receiver := &testReceiver{statuses: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	pusher, gauge, _ := newTestPusher(t, RemoteWrite, server.URL, 10)
+	pusher.config.Interval = 10 * time.Millisecond
+	pusher.config.MinBackoff = 10 * time.Millisecond
+	gauge.Set(1)
+
+	//when
+	pusher.Run()
+	defer pusher.Stop()
+
+	//then
+	deadline := time.Now().Add(5 * time.Second)
+	for len(receiver.received()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Run() => %d batches received, want batches pushed after failure", len(receiver.received()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewPusher_invalidConfig(t *testing.T) {
+	valid := Config{Protocol: RemoteWrite, Interval: time.Minute, Timeout: time.Second, MaxBackoff: time.Minute}
+	tests := []struct {
+		name   string
+		modify func(config *Config)
+	}{
+		{"unknown protocol", func(config *Config) { config.Protocol = "graphite" }},
+		{"zero interval", func(config *Config) { config.Interval = 0 }},
+		{"negative interval", func(config *Config) { config.Interval = -time.Second }},
+		{"zero timeout", func(config *Config) { config.Timeout = 0 }},
+		{"zero max backoff", func(config *Config) { config.MaxBackoff = 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.modify(&config)
+			if _, err := NewPusher(config, prometheus.NewRegistry(), prometheus.NewRegistry(), "test"); err == nil {
+				t.Errorf("NewPusher() expected error of invalid config %+v", config)
+			}
+		})
+	}
+}
+
+func receivedGaugeValue(t *testing.T, protocol Protocol, body []byte) float64 {
+	if protocol == Pushgateway {
+		return decodePushgateway(t, body)["test_gauge"].Metric[0].Gauge.GetValue()
+	}
+	for _, series := range decodeWriteRequest(t, body) {
+		if series.labels[0].value == "test_gauge" {
+			return series.value
+		}
+	}
+	t.Fatalf("test_gauge not pushed")
+	return 0
+}
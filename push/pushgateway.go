@@ -0,0 +1,47 @@
+package push
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// pushgatewayTarget replaces all metrics of job group with every push, so only the latest batch is worth sending
+type pushgatewayTarget struct {
+	url string
+	job string
+}
+
+func (target *pushgatewayTarget) buffered() bool {
+	return false
+}
+
+// encode drops sample timestamps (e.g. with metrics.deviceTimestamps), as pushgateway rejects them
+func (target *pushgatewayTarget) encode(families []*dto.MetricFamily, _ time.Time) ([]byte, error) {
+	format := expfmt.NewFormat(expfmt.TypeProtoDelim)
+	var body bytes.Buffer
+	encoder := expfmt.NewEncoder(&body, format)
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			metric.TimestampMs = nil
+		}
+		if err := encoder.Encode(family); err != nil {
+			return nil, err
+		}
+	}
+	return body.Bytes(), nil
+}
+
+func (target *pushgatewayTarget) newRequest(body []byte) (*http.Request, error) {
+	return newRequest(
+		http.MethodPut,
+		strings.TrimSuffix(target.url, "/")+"/metrics/job/"+url.PathEscape(target.job),
+		body,
+		map[string]string{"Content-Type": string(expfmt.NewFormat(expfmt.TypeProtoDelim))},
+	)
+}
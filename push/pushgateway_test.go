@@ -0,0 +1,86 @@
+package push
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+func decodePushgateway(t *testing.T, body []byte) map[string]*dto.MetricFamily {
+	decoder := expfmt.NewDecoder(bytes.NewReader(body), expfmt.NewFormat(expfmt.TypeProtoDelim))
+	families := make(map[string]*dto.MetricFamily)
+	for {
+		family := &dto.MetricFamily{}
+		if err := decoder.Decode(family); err == io.EOF {
+			return families
+		} else if err != nil {
+			t.Fatalf("invalid pushgateway body: %v", err)
+		}
+		families[family.GetName()] = family
+	}
+}
+
+func TestPushgatewayTarget_encode(t *testing.T) {
+	//given
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "temperature", Help: "help"})
+	gauge.Set(20)
+	registry.MustRegister(timestampedCollector{gauge, time.Unix(900, 0)})
+	families, _ := registry.Gather()
+	target := &pushgatewayTarget{url: "http://localhost", job: "test"}
+
+	//when
+	body, err := target.encode(families, time.Unix(1000, 0))
+
+	//then
+	if err != nil {
+		t.Fatalf("encode() error = %v", err)
+	}
+	metric := decodePushgateway(t, body)["temperature"].Metric[0]
+	if metric.Gauge.GetValue() != 20 || metric.TimestampMs != nil {
+		t.Errorf("encode() = %v, want value 20 without timestamp", metric)
+	}
+}
+
+func TestPushgatewayTarget_newRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		job      string
+		wantPath string
+	}{
+		{"job", "", "mqtt_exporter", "/metrics/job/mqtt_exporter"},
+		{"trailing slash", "/", "mqtt_exporter", "/metrics/job/mqtt_exporter"},
+		{"escaped job", "", "site/a", "/metrics/job/site%2Fa"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//given
+			receiver := &testReceiver{}
+			server := httptest.NewServer(receiver)
+			defer server.Close()
+			pusher, _, _ := newTestPusher(t, Pushgateway, server.URL+tt.url, 1)
+			pusher.target = &pushgatewayTarget{url: server.URL + tt.url, job: tt.job}
+			pusher.collect()
+
+			//when
+			err := pusher.flush()
+
+			//then
+			if err != nil || len(receiver.requests) != 1 {
+				t.Fatalf("flush() error = %v, %d requests received", err, len(receiver.requests))
+			}
+			request := receiver.requests[0]
+			if request.Method != http.MethodPut || request.URL.EscapedPath() != tt.wantPath {
+				t.Errorf("request = %s %s, want PUT %s", request.Method, request.URL.EscapedPath(), tt.wantPath)
+			}
+		})
+	}
+}
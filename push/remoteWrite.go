@@ -0,0 +1,134 @@
+package push
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// remoteWriteTarget sends samples in remote-write 1.0 format: snappy compressed prometheus.WriteRequest protobuf
+type remoteWriteTarget struct {
+	url string
+	job string
+}
+
+type label struct {
+	name  string
+	value string
+}
+
+type timeSeries struct {
+	labels      []label
+	value       float64
+	timestampMs int64
+}
+
+func (target *remoteWriteTarget) buffered() bool {
+	return true
+}
+
+func (target *remoteWriteTarget) encode(families []*dto.MetricFamily, now time.Time) ([]byte, error) {
+	var request []byte
+	for _, series := range target.timeSeries(families, now) {
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, encodeTimeSeries(series))
+	}
+	return snappy.Encode(nil, request), nil
+}
+
+func (target *remoteWriteTarget) newRequest(body []byte) (*http.Request, error) {
+	return newRequest(http.MethodPost, target.url, body, map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	})
+}
+
+// timeSeries flattens metric families the same way Prometheus does when it scrapes them,
+// e.g. histogram becomes _bucket, _sum and _count series
+func (target *remoteWriteTarget) timeSeries(families []*dto.MetricFamily, now time.Time) []timeSeries {
+	var result []timeSeries
+	for _, family := range families {
+		name := family.GetName()
+		for _, metric := range family.Metric {
+			timestamp := now.UnixNano() / int64(time.Millisecond)
+			if metric.TimestampMs != nil {
+				timestamp = metric.GetTimestampMs()
+			}
+			add := func(name string, value float64, extra ...label) {
+				labels := []label{{"__name__", name}}
+				hasJob := false
+				for _, pair := range metric.Label {
+					labels = append(labels, label{pair.GetName(), pair.GetValue()})
+					hasJob = hasJob || pair.GetName() == "job"
+				}
+				if !hasJob {
+					labels = append(labels, label{"job", target.job})
+				}
+				labels = append(labels, extra...)
+				sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+				result = append(result, timeSeries{labels, value, timestamp})
+			}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, metric.Counter.GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, metric.Gauge.GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, metric.Untyped.GetValue())
+			case dto.MetricType_SUMMARY:
+				for _, quantile := range metric.Summary.Quantile {
+					add(name, quantile.GetValue(), label{"quantile", formatFloat(quantile.GetQuantile())})
+				}
+				add(name+"_sum", metric.Summary.GetSampleSum())
+				add(name+"_count", float64(metric.Summary.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				infinite := false
+				for _, bucket := range metric.Histogram.Bucket {
+					add(name+"_bucket", float64(bucket.GetCumulativeCount()), label{"le", formatFloat(bucket.GetUpperBound())})
+					infinite = math.IsInf(bucket.GetUpperBound(), 1)
+				}
+				if !infinite {
+					add(name+"_bucket", float64(metric.Histogram.GetSampleCount()), label{"le", "+Inf"})
+				}
+				add(name+"_sum", metric.Histogram.GetSampleSum())
+				add(name+"_count", float64(metric.Histogram.GetSampleCount()))
+			}
+		}
+	}
+	return result
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// encodeTimeSeries writes TimeSeries message: labels (1) and single sample (2)
+func encodeTimeSeries(series timeSeries) []byte {
+	var message []byte
+	for _, pair := range series.labels {
+		var encoded []byte
+		encoded = protowire.AppendTag(encoded, 1, protowire.BytesType)
+		encoded = protowire.AppendString(encoded, pair.name)
+		encoded = protowire.AppendTag(encoded, 2, protowire.BytesType)
+		encoded = protowire.AppendString(encoded, pair.value)
+		message = protowire.AppendTag(message, 1, protowire.BytesType)
+		message = protowire.AppendBytes(message, encoded)
+	}
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(series.value))
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, uint64(series.timestampMs))
+	message = protowire.AppendTag(message, 2, protowire.BytesType)
+	return protowire.AppendBytes(message, sample)
+}
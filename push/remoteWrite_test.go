@@ -0,0 +1,181 @@
+package push
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest reads WriteRequest the way remote-write receiver does
+func decodeWriteRequest(t *testing.T, body []byte) []timeSeries {
+	request, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("invalid snappy body: %v", err)
+	}
+	var result []timeSeries
+	for _, message := range decodeFields(t, request)[1] {
+		fields := decodeFields(t, message)
+		series := timeSeries{}
+		for _, encodedLabel := range fields[1] {
+			labelFields := decodeFields(t, encodedLabel)
+			series.labels = append(series.labels, label{string(labelFields[1][0]), string(labelFields[2][0])})
+		}
+		sample := fields[2][0]
+		_, _, n := protowire.ConsumeTag(sample)
+		bits, m := protowire.ConsumeFixed64(sample[n:])
+		series.value = math.Float64frombits(bits)
+		_, _, k := protowire.ConsumeTag(sample[n+m:])
+		timestamp, _ := protowire.ConsumeVarint(sample[n+m+k:])
+		series.timestampMs = int64(timestamp)
+		result = append(result, series)
+	}
+	return result
+}
+
+func decodeFields(t *testing.T, message []byte) map[protowire.Number][][]byte {
+	fields := make(map[protowire.Number][][]byte)
+	for len(message) > 0 {
+		number, _, n := protowire.ConsumeTag(message)
+		value, m := protowire.ConsumeBytes(message[n:])
+		if n < 0 || m < 0 {
+			t.Fatalf("invalid protobuf message")
+		}
+		fields[number] = append(fields[number], value)
+		message = message[n+m:]
+	}
+	return fields
+}
+
+func TestRemoteWriteTarget_encode(t *testing.T) {
+	now := time.Unix(1000, 0)
+	deviceLabels := []label{{"device", "sonoff"}}
+	tests := []struct {
+		name      string
+		collector func() prometheus.Collector
+		want      []timeSeries
+	}{
+		{
+			name: "gauge",
+			collector: func() prometheus.Collector {
+				gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "temperature", Help: "help"}, []string{"device"})
+				gauge.WithLabelValues("sonoff").Set(21.5)
+				return gauge
+			},
+			want: []timeSeries{{[]label{{"__name__", "temperature"}, deviceLabels[0], {"job", "test"}}, 21.5, 1000000}},
+		},
+		{
+			name: "counter with job label",
+			collector: func() prometheus.Collector {
+				counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "messages", Help: "help"}, []string{"job"})
+				counter.WithLabelValues("own").Add(3)
+				return counter
+			},
+			want: []timeSeries{{[]label{{"__name__", "messages"}, {"job", "own"}}, 3, 1000000}},
+		},
+		{
+			name: "histogram",
+			collector: func() prometheus.Collector {
+				histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency", Help: "help", Buckets: []float64{0.5}})
+				histogram.Observe(0.25)
+				histogram.Observe(2)
+				return histogram
+			},
+			want: []timeSeries{
+				{[]label{{"__name__", "latency_bucket"}, {"job", "test"}, {"le", "0.5"}}, 1, 1000000},
+				{[]label{{"__name__", "latency_bucket"}, {"job", "test"}, {"le", "+Inf"}}, 2, 1000000},
+				{[]label{{"__name__", "latency_sum"}, {"job", "test"}}, 2.25, 1000000},
+				{[]label{{"__name__", "latency_count"}, {"job", "test"}}, 2, 1000000},
+			},
+		},
+		{
+			name: "summary",
+			collector: func() prometheus.Collector {
+				summary := prometheus.NewSummary(prometheus.SummaryOpts{Name: "size", Help: "help", Objectives: map[float64]float64{0.5: 0.05}})
+				summary.Observe(4)
+				return summary
+			},
+			want: []timeSeries{
+				{[]label{{"__name__", "size"}, {"job", "test"}, {"quantile", "0.5"}}, 4, 1000000},
+				{[]label{{"__name__", "size_sum"}, {"job", "test"}}, 4, 1000000},
+				{[]label{{"__name__", "size_count"}, {"job", "test"}}, 1, 1000000},
+			},
+		},
+		{
+			name: "device timestamp",
+			collector: func() prometheus.Collector {
+				gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "temperature", Help: "help"})
+				gauge.Set(20)
+				return timestampedCollector{gauge, time.Unix(900, 0)}
+			},
+			want: []timeSeries{{[]label{{"__name__", "temperature"}, {"job", "test"}}, 20, 900000}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//given
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(tt.collector())
+			families, _ := registry.Gather()
+			target := &remoteWriteTarget{url: "http://localhost", job: "test"}
+
+			//when
+			body, err := target.encode(families, now)
+
+			//then
+			if err != nil {
+				t.Fatalf("encode() error = %v", err)
+			}
+			if got := decodeWriteRequest(t, body); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("encode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// timestampedCollector exposes metric with fixed timestamp, like gauges with metrics.deviceTimestamps
+type timestampedCollector struct {
+	prometheus.Metric
+	timestamp time.Time
+}
+
+func (collector timestampedCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- collector.Desc()
+}
+
+func (collector timestampedCollector) Collect(metrics chan<- prometheus.Metric) {
+	metrics <- prometheus.NewMetricWithTimestamp(collector.timestamp, collector.Metric)
+}
+
+func TestRemoteWriteTarget_newRequest(t *testing.T) {
+	//given
+	receiver := &testReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	pusher, _, _ := newTestPusher(t, RemoteWrite, server.URL+"/api/v1/write", 1)
+	pusher.collect()
+
+	//when
+	err := pusher.flush()
+
+	//then
+	if err != nil || len(receiver.requests) != 1 {
+		t.Fatalf("flush() error = %v, %d requests received", err, len(receiver.requests))
+	}
+	request := receiver.requests[0]
+	headers := map[string]string{"Content-Encoding": "snappy", "Content-Type": "application/x-protobuf", "X-Prometheus-Remote-Write-Version": "0.1.0"}
+	for name, want := range headers {
+		if got := request.Header.Get(name); got != want {
+			t.Errorf("%s header = %q, want %q", name, got, want)
+		}
+	}
+	if request.Method != http.MethodPost || request.URL.Path != "/api/v1/write" {
+		t.Errorf("request = %s %s, want POST /api/v1/write", request.Method, request.URL.Path)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/klaper_/mqtt_data_exporter/devices"
+	"github.com/klaper_/mqtt_data_exporter/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const reloadModuleId = "naming_reload"
+
+// reloadableProvider is naming provider backed by file which can be read again
+type reloadableProvider interface {
+	Reload() ([]string, error)
+}
+
+type namingReloader struct {
+	providers           []reloadableProvider
+	lock                sync.Mutex
+	lastReloadSucceeded prometheus.Gauge
+	lastReloadTime      prometheus.Gauge
+}
+
+func newNamingReloader(metricsPrefix string, registerer prometheus.Registerer, providers ...reloadableProvider) *namingReloader {
+	reloader := &namingReloader{
+		providers: providers,
+		lastReloadSucceeded: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: metricsPrefix + "_config_last_reload_successful",
+			Help: "Whether the last naming configuration reload attempt was successful",
+		}),
+		lastReloadTime: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: metricsPrefix + "_config_last_reload_success_timestamp_seconds",
+			Help: "Timestamp of the last successful naming configuration reload",
+		}),
+	}
+	reloader.lastReloadSucceeded.Set(1)
+	reloader.lastReloadTime.SetToCurrentTime()
+	registerer.MustRegister(reloader.lastReloadSucceeded, reloader.lastReloadTime)
+	return reloader
+}
+
+func (reloader *namingReloader) reload() error {
+	reloader.lock.Lock()
+	defer reloader.lock.Unlock()
+	var changed []string
+	var failed error
+	// every provider is reloaded, so one invalid file does not hold back the others
+	for _, provider := range reloader.providers {
+		providerChanged, err := provider.Reload()
+		if err != nil {
+			logger.Warn(reloadModuleId, "Naming configuration reload failed, keeping previous configuration: %v", err)
+			failed = err
+			continue
+		}
+		changed = append(changed, providerChanged...)
+	}
+	metricsStore.RetireDevices(changed)
+	if failed != nil {
+		reloader.lastReloadSucceeded.Set(0)
+		return failed
+	}
+	reloader.lastReloadSucceeded.Set(1)
+	reloader.lastReloadTime.SetToCurrentTime()
+	logger.Info(reloadModuleId, "Naming configuration reloaded, %d devices changed", len(changed))
+	return nil
+}
+
+func (reloader *namingReloader) handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			_ = reloader.reload()
+		}
+	}()
+}
+
+func (reloader *namingReloader) watch(file string, pollInterval time.Duration) {
+	devices.NewFileWatcher(file, pollInterval, func() { _ = reloader.reload() }).Run()
+}
+
+func (reloader *namingReloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := reloader.reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
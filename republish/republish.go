@@ -0,0 +1,205 @@
+package republish
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/klaper_/mqtt_data_exporter/backend"
+	"github.com/klaper_/mqtt_data_exporter/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const moduleId = "republish"
+
+const MessagesCount = "republished_messages_total"
+
+const (
+	// queueSize bounds updates waiting for publishing, so slow broker does not block processing of received messages
+	queueSize      = 1000
+	publishTimeout = 10 * time.Second
+)
+
+var placeholder = regexp.MustCompile(`<([a-zA-Z_][a-zA-Z0-9_]*)>`)
+
+// publisher is the part of MQTT client used by Sink
+type publisher interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) MQTT.Token
+}
+
+type Config struct {
+	// Topic is template of topic, e.g. exporter/<group>/<friendly_name>/<metric>; placeholders are <metric>,
+	// <device>, device properties (<friendly_name>, <group> and custom labels) and labels of series (e.g. <sensor_alias>)
+	Topic  string
+	QoS    byte
+	Retain bool
+}
+
+type message struct {
+	Metric    string            `json:"metric"`
+	Device    string            `json:"device"`
+	Labels    map[string]string `json:"labels"`
+	Value     float64           `json:"value"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+type publication struct {
+	topic   string
+	payload []byte
+}
+
+// Sink publishes every gauge update as JSON message to topic built from template
+type Sink struct {
+	config      Config
+	client      publisher
+	ownTopics   *regexp.Regexp
+	queue       chan publication
+	stop        chan struct{}
+	sentCounter *prometheus.CounterVec
+}
+
+func NewSink(config Config, client publisher, registerer prometheus.Registerer, metricsPrefix string) (*Sink, error) {
+	if config.Topic == "" {
+		return nil, fmt.Errorf("empty topic template")
+	}
+	if strings.ContainsAny(config.Topic, "+#") {
+		return nil, fmt.Errorf("topic template %q contains MQTT wildcard", config.Topic)
+	}
+	if !hasLiteralLevel(config.Topic) {
+		// messages on topics matching template are not processed, so template of placeholders only would hide device messages
+		return nil, fmt.Errorf("topic template %q has no level without placeholders", config.Topic)
+	}
+	if config.QoS > 2 {
+		return nil, fmt.Errorf("invalid QoS %d, expected 0, 1 or 2", config.QoS)
+	}
+	sink := &Sink{
+		config:    config,
+		client:    client,
+		ownTopics: topicPattern(config.Topic),
+		queue:     make(chan publication, queueSize),
+		stop:      make(chan struct{}),
+		sentCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: metricsPrefix + "_" + MessagesCount,
+				Help: "Count of gauge updates republished to MQTT by result: published, failed or dropped (too many waiting)",
+			}, []string{"result"}),
+	}
+	if err := registerer.Register(sink.sentCounter); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+// hasLiteralLevel tells whether any topic level of template is fixed, e.g. "exporter" of exporter/<group>/<metric>
+func hasLiteralLevel(template string) bool {
+	for _, level := range strings.Split(template, "/") {
+		if level != "" && !placeholder.MatchString(level) {
+			return true
+		}
+	}
+	return false
+}
+
+// topicPattern matches topics built from template, with every placeholder matching single topic level
+func topicPattern(template string) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	last := 0
+	for _, match := range placeholder.FindAllStringIndex(template, -1) {
+		pattern.WriteString(regexp.QuoteMeta(template[last:match[0]]))
+		pattern.WriteString("[^/]*")
+		last = match[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String())
+}
+
+// Owns tells whether topic could be published by the sink, so exporter does not process its own messages
+func (sink *Sink) Owns(topic string) bool {
+	return sink.ownTopics.MatchString(topic)
+}
+
+// topic fills template; values are made valid topic levels, i.e. "/", "+" and "#" are replaced with "_" and empty value is "_"
+func (sink *Sink) topic(sample backend.Sample) string {
+	return placeholder.ReplaceAllStringFunc(sink.config.Topic, func(match string) string {
+		name := match[1 : len(match)-1]
+		var value string
+		switch name {
+		case "metric":
+			value = sample.Name
+		case "device":
+			value = sample.Device
+		default:
+			var ok bool
+			if value, ok = sample.Properties[name]; !ok {
+				value = sample.Labels[name]
+			}
+		}
+		if value == "" {
+			return "_"
+		}
+		return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(value)
+	})
+}
+
+// Write queues gauge update for publishing; counters are not republished
+func (sink *Sink) Write(sample backend.Sample) {
+	if sample.Kind != backend.Gauge {
+		return
+	}
+	labels := make(map[string]string, len(sample.Properties)+len(sample.Labels))
+	for name, value := range sample.Properties {
+		labels[name] = value
+	}
+	for name, value := range sample.Labels {
+		labels[name] = value
+	}
+	payload, err := json.Marshal(message{Metric: sample.Name, Device: sample.Device, Labels: labels, Value: sample.Value, Timestamp: sample.Timestamp})
+	if err != nil {
+		// e.g. NaN value, which JSON can not represent
+		logger.Debug(moduleId, "Skipping %s update of %s: %v", sample.Name, sample.Device, err)
+		return
+	}
+	select {
+	case sink.queue <- publication{topic: sink.topic(sample), payload: payload}:
+	default:
+		sink.sentCounter.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Run publishes queued updates in background until Stop is called
+func (sink *Sink) Run() {
+	go func() {
+		for {
+			select {
+			case <-sink.stop:
+				return
+			case update := <-sink.queue:
+				sink.publish(update)
+			}
+		}
+	}()
+}
+
+func (sink *Sink) Stop() {
+	close(sink.stop)
+}
+
+func (sink *Sink) publish(update publication) {
+	token := sink.client.Publish(update.topic, sink.config.QoS, sink.config.Retain, update.payload)
+	if !token.WaitTimeout(publishTimeout) {
+		logger.Warn(moduleId, "Timeout publishing to %s", update.topic)
+		sink.sentCounter.WithLabelValues("failed").Inc()
+		return
+	}
+	if err := token.Error(); err != nil {
+		logger.Warn(moduleId, "Could not publish to %s: %v", update.topic, err)
+		sink.sentCounter.WithLabelValues("failed").Inc()
+		return
+	}
+	sink.sentCounter.WithLabelValues("published").Inc()
+}
@@ -0,0 +1,270 @@
+package republish
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/klaper_/mqtt_data_exporter/backend"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type testToken struct {
+	err error
+}
+
+func (token testToken) Wait() bool                     { return true }
+func (token testToken) WaitTimeout(time.Duration) bool { return true }
+func (token testToken) Error() error                   { return token.err }
+
+type published struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  []byte
+}
+
+// testClient records publications instead of sending them to broker
+type testClient struct {
+	lock      sync.Mutex
+	err       error
+	published []published
+}
+
+func (client *testClient) Publish(topic string, qos byte, retained bool, payload interface{}) MQTT.Token {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.published = append(client.published, published{topic, qos, retained, payload.([]byte)})
+	return testToken{client.err}
+}
+
+func (client *testClient) messages() []published {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	return append([]published{}, client.published...)
+}
+
+var testSample = backend.Sample{
+	Name:       "mqtt_exporter_tasmota_sensor_temperature",
+	Kind:       backend.Gauge,
+	Device:     "sonoff",
+	Labels:     map[string]string{"device": "sonoff", "sensor_alias": "outdoor"},
+	Properties: map[string]string{"device": "sonoff", "friendly_name": "Garden", "group": "outside"},
+	Value:      21.5,
+	Timestamp:  time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC),
+}
+
+func newTestSink(t *testing.T, config Config, client *testClient) *Sink {
+	sink, err := NewSink(config, client, prometheus.NewRegistry(), "test")
+	if err != nil {
+		t.Fatalf("NewSink() error = %v", err)
+	}
+	return sink
+}
+
+func TestSink_topic(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		sample   func(sample backend.Sample) backend.Sample
+		want     string
+	}{
+		{"properties and metric", "exporter/<group>/<friendly_name>/<metric>", nil, "exporter/outside/Garden/mqtt_exporter_tasmota_sensor_temperature"},
+		{"device and series label", "exporter/<device>/<sensor_alias>", nil, "exporter/sonoff/outdoor"},
+		{"missing value", "exporter/<room>/<device>", nil, "exporter/_/sonoff"},
+		{
+			"topic level separators and wildcards are replaced", "exporter/<group>/<friendly_name>",
+			func(sample backend.Sample) backend.Sample {
+				sample.Properties = map[string]string{"group": "first/floor", "friendly_name": "Lamp #1+"}
+				return sample
+			},
+			"exporter/first_floor/Lamp _1_",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := newTestSink(t, Config{Topic: tt.template}, &testClient{})
+			sample := testSample
+			if tt.sample != nil {
+				sample = tt.sample(sample)
+			}
+			if got := sink.topic(sample); got != tt.want {
+				t.Errorf("topic() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSink_Write(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        Config
+		clientErr     error
+		sample        func(sample backend.Sample) backend.Sample
+		wantPublished []published
+		wantResults   map[string]float64
+	}{
+		{
+			name:   "gauge is published",
+			config: Config{Topic: "exporter/<group>/<friendly_name>/<metric>", QoS: 1, Retain: true},
+			wantPublished: []published{{
+				"exporter/outside/Garden/mqtt_exporter_tasmota_sensor_temperature", 1, true,
+				[]byte(`{"metric":"mqtt_exporter_tasmota_sensor_temperature","device":"sonoff","labels":{"device":"sonoff","friendly_name":"Garden","group":"outside","sensor_alias":"outdoor"},"value":21.5,"timestamp":"2020-09-13T12:26:40Z"}`),
+			}},
+			wantResults: map[string]float64{"published": 1},
+		},
+		{
+			name:   "counter is not published",
+			config: Config{Topic: "exporter/<metric>"},
+			sample: func(sample backend.Sample) backend.Sample {
+				sample.Kind = backend.Counter
+				return sample
+			},
+			wantResults: map[string]float64{},
+		},
+		{
+			name:   "NaN is not published",
+			config: Config{Topic: "exporter/<metric>"},
+			sample: func(sample backend.Sample) backend.Sample {
+				sample.Value = math.NaN()
+				return sample
+			},
+			wantResults: map[string]float64{},
+		},
+		{
+			name:          "failed publish is counted",
+			config:        Config{Topic: "exporter/<metric>"},
+			clientErr:     errors.New("not connected"),
+			wantPublished: []published{{"exporter/mqtt_exporter_tasmota_sensor_temperature", 0, false, nil}},
+			wantResults:   map[string]float64{"failed": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//given
+			client := &testClient{err: tt.clientErr}
+			sink := newTestSink(t, tt.config, client)
+			sample := testSample
+			if tt.sample != nil {
+				sample = tt.sample(sample)
+			}
+
+			//when
+			sink.Write(sample)
+			close(sink.queue)
+			for update := range sink.queue {
+				sink.publish(update)
+			}
+
+			//then
+			messages := client.messages()
+			if len(messages) != len(tt.wantPublished) {
+				t.Fatalf("Write() published %d messages, want %d", len(messages), len(tt.wantPublished))
+			}
+			for i, want := range tt.wantPublished {
+				got := messages[i]
+				if want.payload == nil {
+					got.payload = nil
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("Write() published %s %d %v %s, want %s %d %v %s", got.topic, got.qos, got.retained, got.payload, want.topic, want.qos, want.retained, want.payload)
+				}
+			}
+			for result, want := range tt.wantResults {
+				if got := testutil.ToFloat64(sink.sentCounter.WithLabelValues(result)); got != want {
+					t.Errorf("Write() => %s messages = %v, want %v", result, got, want)
+				}
+			}
+			if count := testutil.CollectAndCount(sink.sentCounter); count != len(tt.wantResults) {
+				t.Errorf("Write() => %d results counted, want %d", count, len(tt.wantResults))
+			}
+		})
+	}
+}
+
+func TestSink_Write_queueFull(t *testing.T) {
+	//given
+	sink := newTestSink(t, Config{Topic: "exporter/<metric>"}, &testClient{})
+
+	//when
+	for i := 0; i < queueSize+2; i++ {
+		sink.Write(testSample)
+	}
+
+	//then
+	if got := testutil.ToFloat64(sink.sentCounter.WithLabelValues("dropped")); got != 2 {
+		t.Errorf("Write() => dropped messages = %v, want 2", got)
+	}
+}
+
+func TestSink_Run(t *testing.T) {
+	//given
+	client := &testClient{}
+	sink := newTestSink(t, Config{Topic: "exporter/<metric>"}, client)
+	sink.Run()
+	defer sink.Stop()
+
+	//when
+	sink.Write(testSample)
+
+	//then
+	deadline := time.Now().Add(5 * time.Second)
+	for len(client.messages()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Run() => update was not published")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	var payload message
+	if err := json.Unmarshal(client.messages()[0].payload, &payload); err != nil || payload.Value != 21.5 {
+		t.Errorf("Run() published %s, want JSON with value: %v", client.messages()[0].payload, err)
+	}
+}
+
+func TestSink_Owns(t *testing.T) {
+	sink := newTestSink(t, Config{Topic: "exporter/<group>/<friendly_name>/<metric>"}, &testClient{})
+	tests := []struct {
+		topic string
+		want  bool
+	}{
+		{"exporter/outside/Garden/temperature", true},
+		{"exporter/_/_/temperature", true},
+		{"exporter/outside/temperature", false},
+		{"tele/sonoff/SENSOR", false},
+		{"exporter/outside/Garden/temperature/extra", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.topic, func(t *testing.T) {
+			if got := sink.Owns(tt.topic); got != tt.want {
+				t.Errorf("Owns(%q) = %v, want %v", tt.topic, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSink_invalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"empty topic", Config{}},
+		{"wildcard in topic", Config{Topic: "exporter/+/<metric>"}},
+		{"invalid QoS", Config{Topic: "exporter/<metric>", QoS: 3}},
+		{"placeholders only", Config{Topic: "<group>/<friendly_name>/<metric>"}},
+		{"placeholders and empty levels only", Config{Topic: "/<group>/<metric>/"}},
+		{"partially fixed levels only", Config{Topic: "ex_<group>/<metric>"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSink(tt.config, &testClient{}, prometheus.NewRegistry(), "test"); err == nil {
+				t.Errorf("NewSink() expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package tasmota
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/klaper_/mqtt_data_exporter/backend"
+	"github.com/klaper_/mqtt_data_exporter/devices"
+	"github.com/klaper_/mqtt_data_exporter/logger"
+)
+
+const infoClientId = "tasmota_info"
+
+// deviceInfo holds names reported by tasmota entity in STATUS response or discovery message
+type deviceInfo struct {
+	Topic         string
+	DeviceName    string
+	FriendlyNames []string
+}
+
+type infoCollector struct {
+	channel        chan interface{}
+	metricsStore   backend.Store
+	autoNaming     *devices.AutoProperties
+	retainedMaxAge time.Duration
+}
+
+func (info *deviceInfo) UnmarshalJSON(data []byte) error {
+	var tmp struct {
+		Status *struct {
+			Topic        string    `json:"Topic"`
+			DeviceName   string    `json:"DeviceName"`
+			FriendlyName []*string `json:"FriendlyName"`
+		} `json:"Status"`
+		// discovery message uses abbreviated keys
+		Topic        string    `json:"t"`
+		DeviceName   string    `json:"dn"`
+		FriendlyName []*string `json:"fn"`
+	}
+	err := json.Unmarshal(data, &tmp)
+	if err != nil {
+		return err
+	}
+	logger.Debug(infoClientId, "parsed input to: %s", data)
+
+	friendlyNames := tmp.FriendlyName
+	info.Topic, info.DeviceName = tmp.Topic, tmp.DeviceName
+	if tmp.Status != nil {
+		info.Topic, info.DeviceName = tmp.Status.Topic, tmp.Status.DeviceName
+		friendlyNames = tmp.Status.FriendlyName
+	}
+	info.FriendlyNames = nil
+	for _, name := range friendlyNames {
+		if name != nil {
+			info.FriendlyNames = append(info.FriendlyNames, *name)
+		}
+	}
+	return nil
+}
+
+// isInfoMessage accepts "<prefix>/<device>/STATUS" responses and "tasmota/discovery/<mac>/config" messages
+func isInfoMessage(topic string) bool {
+	split := strings.Split(topic, "/")
+	return (len(split) == 3 && split[2] == "STATUS") ||
+		(len(split) == 4 && split[1] == "discovery" && split[3] == "config")
+}
+
+func newInfoCollector(metricsStore backend.Store, autoNaming *devices.AutoProperties, retainedMaxAge time.Duration) *infoCollector {
+	return &infoCollector{
+		channel:        make(chan interface{}),
+		metricsStore:   metricsStore,
+		autoNaming:     autoNaming,
+		retainedMaxAge: retainedMaxAge,
+	}
+}
+
+func (collector *infoCollector) collector() {
+	for tmp := range collector.channel {
+		message, err := receiveMessage(tmp, infoClientId, isInfoMessage, collector.retainedMaxAge)
+		if err != nil {
+			continue
+		}
+
+		info := deviceInfo{}
+		err = json.Unmarshal((message).Payload(), &info)
+		if err != nil {
+			logger.Warn(infoClientId, "error while unmarshaling: %v", err)
+			continue
+		}
+		logger.Debug(infoClientId, "message: %+v", info)
+
+		deviceName := info.Topic
+		if deviceName == "" {
+			deviceName = message.GetDeviceName()
+		}
+		collector.learn(deviceName, info)
+	}
+}
+
+// learn prefers DeviceName and falls back to the first FriendlyName, as older firmware does not report DeviceName
+func (collector *infoCollector) learn(deviceName string, info deviceInfo) {
+	if !collector.autoNaming.Learn(deviceName, append([]string{info.DeviceName}, info.FriendlyNames...)...) {
+		return
+	}
+	logger.Info(infoClientId, "Learned name of device %s from its metadata", deviceName)
+	// series of the device carry previous friendly_name
+	collector.metricsStore.RetireDevices([]string{deviceName})
+}
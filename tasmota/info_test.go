@@ -0,0 +1,56 @@
+package tasmota
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var statusInfo = []byte(`{"Status":{"Module":1,"DeviceName":"Kitchen plug","FriendlyName":["Kettle","Toaster"],"Topic":"plug_01","ButtonTopic":"0","Power":1}}`)
+var discoveryInfo = []byte(`{"ip":"192.168.1.10","dn":"Kitchen plug","fn":["Kettle",null,null,null],"hn":"plug-01","mac":"AABBCCDDEEFF","md":"Sonoff Basic","t":"plug_01"}`)
+
+func Test_unmarshal_deviceInfo(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  deviceInfo
+	}{
+		{"status", statusInfo, deviceInfo{Topic: "plug_01", DeviceName: "Kitchen plug", FriendlyNames: []string{"Kettle", "Toaster"}}},
+		{"discovery", discoveryInfo, deviceInfo{Topic: "plug_01", DeviceName: "Kitchen plug", FriendlyNames: []string{"Kettle"}}},
+		{"old firmware", []byte(`{"Status":{"FriendlyName":["Sonoff"]}}`), deviceInfo{FriendlyNames: []string{"Sonoff"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//given
+			result := deviceInfo{}
+
+			//when
+			err := json.Unmarshal(tt.input, &result)
+
+			//then
+			if err != nil || !reflect.DeepEqual(result, tt.want) {
+				t.Errorf("expected: %+v, got: %+v (error: %v)", tt.want, result, err)
+			}
+		})
+	}
+}
+
+func Test_isInfoMessage(t *testing.T) {
+	tests := []struct {
+		topic string
+		want  bool
+	}{
+		{"stat/plug_01/STATUS", true},
+		{"stat/plug_01/STATUS5", false},
+		{"tasmota/discovery/AABBCCDDEEFF/config", true},
+		{"tasmota/discovery/AABBCCDDEEFF/sensors", false},
+		{"tele/plug_01/STATE", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.topic, func(t *testing.T) {
+			if got := isInfoMessage(tt.topic); got != tt.want {
+				t.Errorf("isInfoMessage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package tasmota
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// jsonString accepts both JSON strings and numbers, as different firmware versions send some fields in either form
+type jsonString string
+
+func (value *jsonString) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	switch data[0] {
+	case '"':
+		var str string
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+		*value = jsonString(str)
+	case '{', '[':
+		return errors.New("expected string or number, got: " + string(data))
+	default:
+		*value = jsonString(data)
+	}
+	return nil
+}
+
+func parseFloat(raw json.RawMessage) (float64, error) {
+	return strconv.ParseFloat(string(raw), 64)
+}
+
+func sortedKeys(data map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
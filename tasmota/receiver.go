@@ -1,6 +1,9 @@
 package tasmota
 
 import (
+	"encoding/json"
+	"time"
+
 	"github.com/klaper_/mqtt_data_exporter/logger"
 	exporterMessage "github.com/klaper_/mqtt_data_exporter/message"
 )
@@ -11,6 +14,9 @@ type NotExporterMessage struct {
 type TopicValidatedToFalse struct {
 	message string
 }
+type StaleRetainedMessage struct {
+	message string
+}
 
 func (err NotExporterMessage) Error() string {
 	return err.message
@@ -20,7 +26,11 @@ func (err TopicValidatedToFalse) Error() string {
 	return err.message
 }
 
-func receiveMessage(tmp interface{}, module string, topicValidator func(string) bool) (*exporterMessage.ExporterMessage, error) {
+func (err StaleRetainedMessage) Error() string {
+	return err.message
+}
+
+func receiveMessage(tmp interface{}, module string, topicValidator func(string) bool, retainedMaxAge time.Duration) (*exporterMessage.ExporterMessage, error) {
 	message, ok := tmp.(*exporterMessage.ExporterMessage)
 	logger.Debug(module, "message: %+v, ok: %t", message, ok)
 	if !ok {
@@ -33,7 +43,30 @@ func receiveMessage(tmp interface{}, module string, topicValidator func(string)
 		message.ProcessMessage(module, exporterMessage.Ignored)
 		return nil, TopicValidatedToFalse{message: "Skipped due to wrong topic"}
 	}
+	if isStaleRetainedMessage(message, retainedMaxAge, time.Now()) {
+		logger.Debug(module, "Message(%d) was skipped due to being retained and older than %s", (message).MessageID(), retainedMaxAge)
+		message.ProcessMessage(module, exporterMessage.Stale)
+		return nil, StaleRetainedMessage{message: "Skipped due to stale retained message"}
+	}
 	message.ProcessMessage(module, exporterMessage.Processed)
 	logger.Debug(module, "Message(%d) was processed", (message).MessageID())
 	return message, nil
 }
+
+// isStaleRetainedMessage checks device "Time" of retained messages, which are replayed by broker on every (re)connect
+func isStaleRetainedMessage(message *exporterMessage.ExporterMessage, retainedMaxAge time.Duration, now time.Time) bool {
+	if retainedMaxAge == 0 || !message.Retained() {
+		return false
+	}
+	var payload struct {
+		Time string `json:"Time"`
+	}
+	if err := json.Unmarshal(message.Payload(), &payload); err != nil {
+		return false
+	}
+	deviceTime, err := parseTime(payload.Time)
+	if err != nil {
+		return false
+	}
+	return now.Sub(deviceTime) > retainedMaxAge
+}
@@ -3,6 +3,7 @@ package tasmota
 import (
 	"github.com/klaper_/mqtt_data_exporter/prom"
 	"testing"
+	"time"
 
 	exporterMessage "github.com/klaper_/mqtt_data_exporter/message"
 )
@@ -11,6 +12,7 @@ type messageMock struct {
 	topic      string
 	payload    []byte
 	deviceName string
+	retained   bool
 }
 
 func (e messageMock) Duplicate() bool {
@@ -22,7 +24,7 @@ func (e messageMock) Qos() byte {
 }
 
 func (e messageMock) Retained() bool {
-	return false
+	return e.retained
 }
 
 func (e messageMock) Topic() string {
@@ -45,7 +47,7 @@ func Test_receiveMessageNonMessage(t *testing.T) {
 	inputModule := "module"
 
 	//when
-	result, err := receiveMessage(inputTmp, inputModule, func(string) bool { return true })
+	result, err := receiveMessage(inputTmp, inputModule, func(string) bool { return true }, 0)
 
 	//then
 	if _, ok := err.(NotExporterMessage); !ok || result != nil {
@@ -57,12 +59,12 @@ func Test_receiveMessageDifferentTopic(t *testing.T) {
 	//given
 	inputTmp := exporterMessage.NewExporterMessage(
 		messageMock{topic: "some/topic/value"},
-		prom.NewMetrics("", nil, 0),
+		prom.NewMetrics("", nil, 0, prom.Options{}),
 	)
 	inputModule := "module"
 
 	//when
-	result, err := receiveMessage(inputTmp, inputModule, func(string) bool { return false })
+	result, err := receiveMessage(inputTmp, inputModule, func(string) bool { return false }, 0)
 
 	//then
 	if _, ok := err.(TopicValidatedToFalse); !ok || result != nil {
@@ -74,15 +76,62 @@ func Test_receiveMessageSameTopic(t *testing.T) {
 	//given
 	inputTmp := exporterMessage.NewExporterMessage(
 		messageMock{topic: "some/topic/value"},
-		prom.NewMetrics("", nil, 0),
+		prom.NewMetrics("", nil, 0, prom.Options{}),
 	)
 	inputModule := "module"
 
 	//when
-	result, err := receiveMessage(inputTmp, inputModule, func(string) bool { return true })
+	result, err := receiveMessage(inputTmp, inputModule, func(string) bool { return true }, 0)
 
 	//then
 	if result == nil || err != nil {
 		t.Errorf("CorrectMessage => Error was: %+v (expecting: nil), and Result was: %+v (expected: not nil)", err, result)
 	}
 }
+
+func Test_receiveMessageStaleRetained(t *testing.T) {
+	//given
+	payload := []byte("{\"Time\":\"" + time.Now().Add(-2*time.Hour).Format("2006-01-02T15:04:05") + "\"}")
+	inputTmp := exporterMessage.NewExporterMessage(
+		messageMock{topic: "some/topic/value", payload: payload, retained: true},
+		prom.NewMetrics("", nil, 0, prom.Options{}),
+	)
+	inputModule := "module"
+
+	//when
+	result, err := receiveMessage(inputTmp, inputModule, func(string) bool { return true }, time.Hour)
+
+	//then
+	if _, ok := err.(StaleRetainedMessage); !ok || result != nil {
+		t.Errorf("StaleRetainedMessage => Error was: %q (expecting: StaleRetainedMessage), and Result was: %+v (expected: nil)", err, result)
+	}
+}
+
+func Test_isStaleRetainedMessage(t *testing.T) {
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		name     string
+		payload  string
+		retained bool
+		maxAge   time.Duration
+		want     bool
+	}{
+		{"not retained", "{\"Time\":\"2020-03-01T08:00:00\"}", false, time.Hour, false},
+		{"disabled", "{\"Time\":\"2020-03-01T08:00:00\"}", true, 0, false},
+		{"retained and old", "{\"Time\":\"2020-03-01T08:00:00\"}", true, time.Hour, true},
+		{"retained and fresh", "{\"Time\":\"2020-03-01T11:30:00\"}", true, time.Hour, false},
+		{"retained without time", "{\"POWER\":\"ON\"}", true, time.Hour, false},
+		{"retained non json", "ON", true, time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := exporterMessage.NewExporterMessage(
+				messageMock{topic: "tele/device/STATE", payload: []byte(tt.payload), retained: tt.retained},
+				nil,
+			)
+			if got := isStaleRetainedMessage(message, tt.maxAge, now); got != tt.want {
+				t.Errorf("isStaleRetainedMessage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package tasmota
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/klaper_/mqtt_data_exporter/backend"
+	"github.com/klaper_/mqtt_data_exporter/logger"
+)
+
+const resultClientId = "tasmota_result"
+
+// otherCode replaces RF/IR codes that are not on the allowlist
+const otherCode = "other"
+
+// AllResultCodes put on the allowlist exports every RF/IR code as label value
+const AllResultCodes = "*"
+
+var indexedEventFields = regexp.MustCompile(`^(Button|Switch)(\d+)$`)
+
+type resultEventType string
+
+const (
+	rfReceived resultEventType = "RfReceived"
+	irReceived resultEventType = "IrReceived"
+	button     resultEventType = "Button"
+	switchKey  resultEventType = "Switch"
+)
+
+type resultEvent struct {
+	Type     resultEventType
+	Index    string
+	Protocol string
+	Code     string
+	Action   string
+}
+
+type result struct {
+	Events []resultEvent
+}
+
+type resultCollector struct {
+	channel        chan interface{}
+	metricsStore   backend.Store
+	allowedCodes   map[string]bool
+	retainedMaxAge time.Duration
+}
+
+func (result *result) UnmarshalJSON(data []byte) error {
+	var tmp map[string]json.RawMessage
+	err := json.Unmarshal(data, &tmp)
+	if err != nil {
+		return err
+	}
+	logger.Debug(resultClientId, "parsed input to: %s", data)
+
+	result.Events = getResultEvents(tmp)
+
+	return nil
+}
+
+func getResultEvents(data map[string]json.RawMessage) (events []resultEvent) {
+	for _, eventType := range []resultEventType{rfReceived, irReceived} {
+		if tmp, ok := data[string(eventType)]; ok {
+			if event, ok := getReceivedEvent(eventType, tmp); ok {
+				events = append(events, event)
+			}
+		}
+	}
+
+	for _, key := range sortedKeys(data) {
+		matches := indexedEventFields.FindStringSubmatch(key)
+		if matches == nil {
+			continue
+		}
+		if action, ok := getAction(data[key]); ok {
+			events = append(events, resultEvent{
+				Type:   resultEventType(matches[1]),
+				Index:  matches[2],
+				Action: action,
+			})
+		}
+	}
+	return
+}
+
+func getReceivedEvent(eventType resultEventType, input json.RawMessage) (resultEvent, bool) {
+	var data struct {
+		Data     jsonString `json:"Data"`
+		Protocol jsonString `json:"Protocol"`
+	}
+	if err := json.Unmarshal(input, &data); err != nil {
+		logger.Warn(resultClientId, "[%s] Got wrong type for event data: %v", eventType, err)
+		return resultEvent{}, false
+	}
+	if data.Data == "" {
+		logger.Warn(resultClientId, "[%s] Event has no Data field: %s", eventType, input)
+		return resultEvent{}, false
+	}
+	return resultEvent{Type: eventType, Protocol: string(data.Protocol), Code: string(data.Data)}, true
+}
+
+func getAction(input json.RawMessage) (string, bool) {
+	var action jsonString
+	if err := json.Unmarshal(input, &action); err == nil {
+		return string(action), true
+	}
+	var data struct {
+		Action *jsonString `json:"Action"`
+	}
+	if err := json.Unmarshal(input, &data); err == nil && data.Action != nil {
+		return string(*data.Action), true
+	}
+	logger.Warn(resultClientId, "Could not get action from: %s", input)
+	return "", false
+}
+
+func isResultMessage(topic string) bool {
+	split := strings.Split(topic, "/")
+	return len(split) == 3 && split[2] == "RESULT"
+}
+
+func newResultCollector(metricsStore backend.Store, allowedCodes []string, retainedMaxAge time.Duration) (collector *resultCollector) {
+	metricsStore.RegisterCounter(
+		"rfReceivedCounter",
+		"tasmota_rf_received",
+		"Count of RF codes received by tasmota entity",
+		[]string{"protocol", "code"},
+	)
+	metricsStore.RegisterCounter(
+		"irReceivedCounter",
+		"tasmota_ir_received",
+		"Count of IR codes received by tasmota entity",
+		[]string{"protocol", "code"},
+	)
+	metricsStore.RegisterCounter(
+		"buttonCounter",
+		"tasmota_button_action",
+		"Count of button actions of tasmota entity",
+		[]string{"button", "action"},
+	)
+	metricsStore.RegisterCounter(
+		"switchCounter",
+		"tasmota_switch_action",
+		"Count of switch actions of tasmota entity",
+		[]string{"switch", "action"},
+	)
+	metricsStore.RegisterGauge(
+		"switchStateGauge",
+		"tasmota_switch_state",
+		"Switch state of tasmota entity",
+		[]string{"switch"},
+	)
+	allowed := make(map[string]bool, len(allowedCodes))
+	for _, code := range allowedCodes {
+		allowed[code] = true
+	}
+	return &resultCollector{
+		channel:        make(chan interface{}),
+		metricsStore:   metricsStore,
+		allowedCodes:   allowed,
+		retainedMaxAge: retainedMaxAge,
+	}
+}
+
+// filterCode returns the code itself only when it is on the allowlist (or all codes are allowed),
+// as every remote button or neighbour's 433 MHz sensor would create new series otherwise
+func (collector *resultCollector) filterCode(code string) string {
+	if collector.allowedCodes[AllResultCodes] || collector.allowedCodes[code] {
+		return code
+	}
+	return otherCode
+}
+
+func (collector *resultCollector) collector() {
+	for tmp := range collector.channel {
+		message, err := receiveMessage(tmp, resultClientId, isResultMessage, collector.retainedMaxAge)
+		if err != nil {
+			continue
+		}
+
+		result := result{}
+		err = json.Unmarshal((message).Payload(), &result)
+		if err != nil {
+			logger.Fatal(resultClientId, "error while unmarshaling", err)
+			continue
+		}
+		logger.Debug(resultClientId, "message: %+v", result)
+
+		collector.updateState(message.GetDeviceName(), result)
+	}
+}
+
+func (collector *resultCollector) updateState(deviceName string, result result) {
+	for _, event := range result.Events {
+		switch event.Type {
+		case rfReceived:
+			collector.metricsStore.CounterInc(
+				"rfReceivedCounter",
+				deviceName,
+				map[string]string{"protocol": event.Protocol, "code": collector.filterCode(event.Code)},
+			)
+		case irReceived:
+			collector.metricsStore.CounterInc(
+				"irReceivedCounter",
+				deviceName,
+				map[string]string{"protocol": event.Protocol, "code": collector.filterCode(event.Code)},
+			)
+		case button:
+			collector.metricsStore.CounterInc(
+				"buttonCounter",
+				deviceName,
+				map[string]string{"button": event.Index, "action": event.Action},
+			)
+		case switchKey:
+			collector.metricsStore.CounterInc(
+				"switchCounter",
+				deviceName,
+				map[string]string{"switch": event.Index, "action": event.Action},
+			)
+			if event.Action == "ON" || event.Action == "OFF" {
+				collector.metricsStore.GaugeSet(
+					"switchStateGauge",
+					deviceName,
+					map[string]string{"switch": event.Index},
+					parsePower(event.Action),
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package tasmota
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var rfResult = []byte("{\"RfReceived\":{\"Sync\":14060,\"Low\":470,\"High\":1370,\"Data\":\"E5CD7E\",\"RfKey\":\"None\"}}")
+var irResult = []byte("{\"IrReceived\":{\"Protocol\":\"NEC\",\"Bits\":32,\"Data\":\"0x00FF00FF\"}}")
+var buttonResult = []byte("{\"Button1\":{\"Action\":\"SINGLE\"},\"Switch2\":{\"Action\":\"ON\"},\"Switch3\":\"OFF\"}")
+
+func Test_unmarshal_rfReceived(t *testing.T) {
+	//given
+	expected := []resultEvent{{Type: rfReceived, Code: "E5CD7E"}}
+	result := result{}
+
+	//when
+	json.Unmarshal(rfResult, &result)
+
+	//then
+	if !reflect.DeepEqual(result.Events, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, result.Events)
+	}
+}
+
+func Test_unmarshal_irReceived(t *testing.T) {
+	//given
+	expected := []resultEvent{{Type: irReceived, Protocol: "NEC", Code: "0x00FF00FF"}}
+	result := result{}
+
+	//when
+	json.Unmarshal(irResult, &result)
+
+	//then
+	if !reflect.DeepEqual(result.Events, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, result.Events)
+	}
+}
+
+func Test_unmarshal_rfReceived_numericProtocol(t *testing.T) {
+	//given
+	input := []byte("{\"RfReceived\":{\"Data\":\"0x7F0F0\",\"Bits\":24,\"Protocol\":1,\"Pulse\":350}}")
+	expected := []resultEvent{{Type: rfReceived, Protocol: "1", Code: "0x7F0F0"}}
+	result := result{}
+
+	//when
+	json.Unmarshal(input, &result)
+
+	//then
+	if !reflect.DeepEqual(result.Events, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, result.Events)
+	}
+}
+
+func Test_unmarshal_buttonsAndSwitches(t *testing.T) {
+	//given
+	expected := []resultEvent{
+		{Type: button, Index: "1", Action: "SINGLE"},
+		{Type: switchKey, Index: "2", Action: "ON"},
+		{Type: switchKey, Index: "3", Action: "OFF"},
+	}
+	result := result{}
+
+	//when
+	json.Unmarshal(buttonResult, &result)
+
+	//then
+	if !reflect.DeepEqual(result.Events, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, result.Events)
+	}
+}
+
+func Test_unmarshal_commandResult(t *testing.T) {
+	//given
+	input := []byte("{\"POWER\":\"ON\"}")
+	result := result{}
+
+	//when
+	json.Unmarshal(input, &result)
+
+	//then
+	if len(result.Events) != 0 {
+		t.Errorf("expected no events, got: %+v", result.Events)
+	}
+}
+
+func Test_resultCollector_filterCode(t *testing.T) {
+	tests := []struct {
+		name         string
+		allowedCodes map[string]bool
+		code         string
+		want         string
+	}{
+		{"no allowlist", map[string]bool{}, "E5CD7E", otherCode},
+		{"all codes allowed", map[string]bool{AllResultCodes: true}, "E5CD7E", "E5CD7E"},
+		{"code on allowlist", map[string]bool{"E5CD7E": true}, "E5CD7E", "E5CD7E"},
+		{"code not on allowlist", map[string]bool{"E5CD7E": true}, "A1B2C3", otherCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collector := &resultCollector{allowedCodes: tt.allowedCodes}
+			if got := collector.filterCode(tt.code); got != tt.want {
+				t.Errorf("filterCode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isResultMessage(t *testing.T) {
+	//given
+	input := []string{"tele/device/RESULT", "stat/device/RESULT", "tele/device_2/SENSOR", "tele/device/RESULT/other"}
+	expected := []bool{true, true, false, false}
+
+	//when
+	for i := range input {
+		result := isResultMessage(input[i])
+		if result != expected[i] {
+			t.Errorf("isResultMessage => For: %q expected: %t, but got %t", input[i], expected[i], result)
+		}
+	}
+}
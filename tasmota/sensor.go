@@ -1,14 +1,14 @@
 package tasmota
 
 import (
+	"encoding/json"
 	"errors"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/klaper_/mqtt_data_exporter/backend"
 	"github.com/klaper_/mqtt_data_exporter/logger"
-	"github.com/klaper_/mqtt_data_exporter/prom"
-
-	"gopkg.in/yaml.v3"
 )
 
 const sensorClientId = "tasmota_sensor"
@@ -17,6 +17,27 @@ var sensorNames = []string{"SI7021", "SDS0X1", "BH1750", "BMP280", "BME280", "EN
 var sensorTypes = []sensorType{temperature, pressure, humidity, pm10, pm2, illuminance, current, voltage, power, apparentPower, reactivePower, total}
 var unitFields = regexp.MustCompile("Unit$")
 
+// unitReadouts maps tasmota *Unit fields to readouts they describe, openMetricsUnits maps their values to OpenMetrics unit names;
+// reported units are only checked against configured ones, as unit of exposed gauge can not change at runtime
+var unitReadouts = map[string]sensorType{"TempUnit": temperature, "PressureUnit": pressure}
+var openMetricsUnits = map[string]string{"C": "celsius", "F": "fahrenheit", "hPa": "hectopascals", "mmHg": "millimeters_of_mercury", "inHg": "inches_of_mercury"}
+var indexedBlockFields = regexp.MustCompile(`^(Shutter|Thermostat)(\d+)$`)
+
+// indexedBlocks lists readouts of numbered blocks (e.g. "Shutter1", "Thermostat0") exported as separate gauges
+var indexedBlocks = map[string][]blockField{
+	"Shutter": {
+		{shutterPosition, "tasmota_shutter_position", "Position of tasmota shutter in percent"},
+		{shutterDirection, "tasmota_shutter_direction", "Direction of tasmota shutter movement (-1 = closing, 0 = stopped, 1 = opening)"},
+		{shutterTarget, "tasmota_shutter_target", "Target position of tasmota shutter in percent"},
+	},
+	"Thermostat": {
+		{thermostatSetpoint, "tasmota_thermostat_setpoint", "Target temperature of tasmota thermostat"},
+		{thermostatControlMethod, "tasmota_thermostat_control_method", "Control method of tasmota thermostat (0 = hybrid, 1 = PI, 2 = ramp-up)"},
+		{thermostatOutput, "tasmota_thermostat_output", "Output duty cycle of tasmota thermostat in percent"},
+		{thermostatMode, "tasmota_thermostat_mode", "Mode of tasmota thermostat (0 = off, 1 = automatic, 2 = manual)"},
+	},
+}
+
 type sensorType string
 
 const (
@@ -34,85 +55,103 @@ const (
 	apparentPower sensorType = "ApparentPower"
 	reactivePower sensorType = "ReactivePower"
 	total         sensorType = "Total"
+
+	// Shutter block metrics
+	shutterPosition  sensorType = "Position"
+	shutterDirection sensorType = "Direction"
+	shutterTarget    sensorType = "Target"
+
+	// Thermostat block metrics
+	thermostatSetpoint      sensorType = "TempTargetSet"
+	thermostatControlMethod sensorType = "ControllerMethodSet"
+	thermostatOutput        sensorType = "CtrDutyCycleRead"
+	thermostatMode          sensorType = "ThermostatModeSet"
 )
 
+type blockField struct {
+	Type        sensorType
+	Name        string
+	Description string
+}
+
 type sensorCollector struct {
-	channel      chan interface{}
-	metricsStore *prom.Metrics
+	channel        chan interface{}
+	metricsStore   backend.Store
+	retainedMaxAge time.Duration
+	// units are configured OpenMetrics units of readouts, mismatchedUnits remembers devices already warned about
+	units           map[sensorType]string
+	mismatchedUnits map[string]bool
 }
 
 type sensorData struct {
 	Type       sensorType
 	SensorName string
 	Value      float64
+	Block      string
+	Index      string
 }
 
 type sensor struct {
 	DeviceName string
+	Time       time.Time
 	Sensors    []sensorData
+	Units      map[sensorType]string
 }
 
-func (sensor *sensor) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	var tmp map[string]interface{}
-	err := unmarshal(&tmp)
+func (sensor *sensor) UnmarshalJSON(data []byte) error {
+	var tmp map[string]json.RawMessage
+	err := json.Unmarshal(data, &tmp)
 	if err != nil {
 		return err
 	}
-	logger.Debug(sensorClientId, "parsed input to: %+v", tmp)
+	logger.Debug(sensorClientId, "parsed input to: %s", data)
 
-	sensor.Sensors = getSensorData(tmp)
+	sensor.Sensors = append(getSensorData(tmp), getIndexedBlockData(tmp)...)
+	sensor.Units = getUnits(tmp)
+	if rawTime, ok := tmp["Time"]; ok {
+		var deviceTime string
+		if err := json.Unmarshal(rawTime, &deviceTime); err == nil {
+			sensor.Time, _ = parseTime(deviceTime)
+		}
+	}
 
 	return nil
 }
 
-func getSensorData(data map[string]interface{}) (sensors []sensorData) {
+func getSensorData(data map[string]json.RawMessage) (sensors []sensorData) {
 	for i := range sensorNames {
 		tmp, ok := data[sensorNames[i]]
-		if ok {
-			for t := range sensorTypes {
-				value, err := getSingleReadout(sensorNames[i], sensorTypes[t], tmp)
-				if err != nil {
-					continue
-				}
-				sensors = append(sensors, *value)
+		if !ok {
+			continue
+		}
+		var readouts map[string]json.RawMessage
+		if err := json.Unmarshal(tmp, &readouts); err != nil {
+			logger.Warn(sensorClientId, "[sensorName: %s] Got wrong type for sensor data: %v", sensorNames[i], err)
+			continue
+		}
+		for t := range sensorTypes {
+			value, err := getSingleReadout(sensorNames[i], sensorTypes[t], readouts)
+			if err != nil {
+				continue
 			}
+			sensors = append(sensors, *value)
 		}
 	}
 	return
 }
 
-func getSingleReadout(sensorName string, sensorType sensorType, input interface{}) (*sensorData, error) {
-	var value float64
-	var ok bool
-
-	data, ok := input.(map[interface{}]interface{})
+func getSingleReadout(sensorName string, sensorType sensorType, data map[string]json.RawMessage) (*sensorData, error) {
+	raw, ok := data[string(sensorType)]
 	if !ok {
-		logger.Warn(sensorClientId, "[sensorType: %s][1] Got wrong type (%T) for sensor data", sensorType, input)
-		return nil, errors.New("got wrong type for sensor data")
+		logger.Debug(sensorClientId, "[sensorType: %s] No sensor value for %s", sensorType, sensorName)
+		return nil, errors.New("sensor value not found")
 	}
-	logger.Debug(sensorClientId, "[sensorType: %s][2] Got sensor data: %+v", sensorType, data)
-	interfaceValue, ok := data[string(sensorType)]
-	if !ok {
-		logger.Warn(sensorClientId, "[sensorType: %s][3] Could not get sensor value, got: %+v", sensorType, interfaceValue)
+	value, err := parseFloat(raw)
+	if err != nil {
+		logger.Warn(sensorClientId, "[sensorType: %s] Could not get sensor value, got: %s", sensorType, raw)
 		return nil, errors.New("got wrong type for sensor data")
 	}
-
-	switch interfaceValue.(type) {
-	case float64:
-		value, ok = interfaceValue.(float64)
-		if !ok {
-			logger.Warn(sensorClientId, "[sensorType: %s][7][float64] Could not get sensor value, got: %+v (%T)", sensorType, interfaceValue, interfaceValue)
-			return nil, errors.New("got wrong type for sensor data")
-		}
-	case int:
-		intValue, ok := interfaceValue.(int)
-		if !ok {
-			logger.Warn(sensorClientId, "[sensorType: %s][8][int] Could not get int value, got: %+v (%T)", sensorType, interfaceValue, interfaceValue)
-			return nil, errors.New("got wrong type for sensor data")
-		}
-		value = float64(intValue)
-	}
-	logger.Debug(sensorClientId, "[sensorType: %s][9] Parsed sensor value to: (%T) %+v", sensorType, value, value)
+	logger.Debug(sensorClientId, "[sensorType: %s] Parsed sensor value to: %f", sensorType, value)
 
 	return &sensorData{
 			Type:       sensorType,
@@ -122,6 +161,56 @@ func getSingleReadout(sensorName string, sensorType sensorType, input interface{
 		nil
 }
 
+func getIndexedBlockData(data map[string]json.RawMessage) (sensors []sensorData) {
+	for _, key := range sortedKeys(data) {
+		matches := indexedBlockFields.FindStringSubmatch(key)
+		if matches == nil {
+			continue
+		}
+		var block map[string]json.RawMessage
+		if err := json.Unmarshal(data[key], &block); err != nil {
+			logger.Warn(sensorClientId, "[%s] Got wrong type for block data: %v", key, err)
+			continue
+		}
+		for _, field := range indexedBlocks[matches[1]] {
+			raw, ok := block[string(field.Type)]
+			if !ok {
+				continue
+			}
+			value, err := parseFloat(raw)
+			if err != nil {
+				logger.Warn(sensorClientId, "[%s] Could not get %s value, got: %s", key, field.Type, raw)
+				continue
+			}
+			sensors = append(sensors, sensorData{
+				Type:       field.Type,
+				SensorName: key,
+				Value:      value,
+				Block:      matches[1],
+				Index:      matches[2],
+			})
+		}
+	}
+	return
+}
+
+func getUnits(data map[string]json.RawMessage) map[sensorType]string {
+	units := make(map[sensorType]string)
+	for field, readout := range unitReadouts {
+		var unit string
+		if raw, ok := data[field]; ok && json.Unmarshal(raw, &unit) == nil {
+			if name, known := openMetricsUnits[unit]; known {
+				units[readout] = name
+			}
+		}
+	}
+	return units
+}
+
+func blockMetricsKey(block string, sensorType sensorType) string {
+	return block + string(sensorType)
+}
+
 func getKeys(input map[string]interface{}) (keys []string, units []string) {
 	for k := range input {
 		if unitFields.MatchString(k) {
@@ -138,13 +227,22 @@ func isSensorMessage(topic string) bool {
 	return len(split) == 3 && split[2] == "SENSOR"
 }
 
-func newSensorCollector(metricsStore *prom.Metrics) (collector *sensorCollector) {
+// isSensorOrResultMessage accepts RESULT messages as well, since shutter blocks are also published there
+func isSensorOrResultMessage(topic string) bool {
+	return isSensorMessage(topic) || isResultMessage(topic)
+}
+
+// newSensorCollector registers sensor gauges; units (readout=unit, e.g. Temperature=celsius) are appended to names
+// of their gauges, e.g. tasmota_sensor_temperature_celsius
+func newSensorCollector(metricsStore backend.Store, units map[string]string, retainedMaxAge time.Duration) (collector *sensorCollector) {
+	sensorUnits := configuredUnits(units)
 	for sensor := range sensorTypes {
 		if !strings.HasPrefix(string(sensorTypes[sensor]), "PM") {
-			metricsStore.RegisterGauge(
+			metricsStore.RegisterGaugeWithUnit(
 				string(sensorTypes[sensor]),
-				"tasmota_sensor_"+strings.Replace(strings.ToLower(string(sensorTypes[sensor])), ".", "", 1),
+				"tasmota_sensor_"+strings.ToLower(string(sensorTypes[sensor])),
 				string(sensorTypes[sensor])+" tasmota sensor data",
+				sensorUnits[sensorTypes[sensor]],
 				[]string{"sensor_name"},
 			)
 		}
@@ -155,24 +253,59 @@ func newSensorCollector(metricsStore *prom.Metrics) (collector *sensorCollector)
 		"PM tasmota entity",
 		[]string{"sensor_name", "resolution"},
 	)
+	for block, fields := range indexedBlocks {
+		for _, field := range fields {
+			metricsStore.RegisterGauge(
+				blockMetricsKey(block, field.Type),
+				field.Name,
+				field.Description,
+				[]string{"sensor_name", strings.ToLower(block)},
+			)
+		}
+	}
 	return &sensorCollector{
-		channel:      make(chan interface{}),
-		metricsStore: metricsStore,
+		channel:         make(chan interface{}),
+		metricsStore:    metricsStore,
+		retainedMaxAge:  retainedMaxAge,
+		units:           sensorUnits,
+		mismatchedUnits: make(map[string]bool),
+	}
+}
+
+func configuredUnits(units map[string]string) map[sensorType]string {
+	result := make(map[sensorType]string, len(units))
+	for readout, unit := range units {
+		if !isUnitReadout(sensorType(readout)) {
+			logger.Warn(sensorClientId, "Unit %s of unknown sensor readout %s is ignored", unit, readout)
+			continue
+		}
+		result[sensorType(readout)] = unit
 	}
+	return result
+}
+
+// isUnitReadout tells whether readout is exported as gauge of its own, so it can have a unit
+func isUnitReadout(readout sensorType) bool {
+	for _, known := range sensorTypes {
+		if known == readout && !strings.HasPrefix(string(known), "PM") {
+			return true
+		}
+	}
+	return false
 }
 
 func (collector *sensorCollector) collector() {
 	for tmp := range collector.channel {
-		message, err := receiveMessage(tmp, sensorClientId, isSensorMessage)
+		message, err := receiveMessage(tmp, sensorClientId, isSensorOrResultMessage, collector.retainedMaxAge)
 		if err != nil {
 			continue
 		}
 
 		sensor := sensor{}
-		err = yaml.Unmarshal((message).Payload(), &sensor)
+		err = json.Unmarshal((message).Payload(), &sensor)
 		if err != nil {
 			logger.Fatal(sensorClientId, "error while unmarshaling", err)
-			return
+			continue
 		}
 		sensor.DeviceName = message.GetDeviceName()
 		logger.Info(sensorClientId, "message: %+v", sensor)
@@ -182,28 +315,58 @@ func (collector *sensorCollector) collector() {
 }
 
 func (collector *sensorCollector) updateState(sensor sensor) {
+	collector.checkUnits(sensor)
 	for i := range sensor.Sensors {
 		data := sensor.Sensors[i]
-		if !strings.HasPrefix(string(data.Type), "PM") {
-			data := sensor.Sensors[i]
-			collector.metricsStore.GaugeSet(
+		if data.Block != "" {
+			collector.metricsStore.SensorGaugeSet(
+				blockMetricsKey(data.Block, data.Type),
+				sensor.DeviceName,
+				string(data.Type),
+				map[string]string{
+					"sensor_name":               data.SensorName,
+					strings.ToLower(data.Block): data.Index,
+				},
+				data.Value,
+				sensor.Time,
+			)
+		} else if !strings.HasPrefix(string(data.Type), "PM") {
+			collector.metricsStore.SensorGaugeSet(
 				string(data.Type),
 				sensor.DeviceName,
+				string(data.Type),
 				map[string]string{
 					"sensor_name": data.SensorName,
 				},
 				data.Value,
+				sensor.Time,
 			)
 		} else {
-			collector.metricsStore.GaugeSet(
+			collector.metricsStore.SensorGaugeSet(
 				"pm",
 				sensor.DeviceName,
+				string(data.Type),
 				map[string]string{
 					"sensor_name": data.SensorName,
 					"resolution":  string(data.Type),
 				},
 				data.Value,
+				sensor.Time,
 			)
 		}
 	}
 }
+
+// checkUnits warns (once per device and readout) about devices reporting readout in other than configured unit,
+// e.g. tasmota with SetOption8 reporting fahrenheit under celsius gauge
+func (collector *sensorCollector) checkUnits(sensor sensor) {
+	for readout, unit := range sensor.Units {
+		configured, ok := collector.units[readout]
+		key := sensor.DeviceName + "/" + string(readout)
+		if !ok || configured == unit || collector.mismatchedUnits[key] {
+			continue
+		}
+		collector.mismatchedUnits[key] = true
+		logger.Warn(sensorClientId, "Device %s reports %s in %s, but it is exported in %s", sensor.DeviceName, readout, unit, configured)
+	}
+}
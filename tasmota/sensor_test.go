@@ -1,7 +1,12 @@
 package tasmota
 
 import (
+	"encoding/json"
+	"reflect"
 	"testing"
+
+	"github.com/klaper_/mqtt_data_exporter/logger"
+	"github.com/klaper_/mqtt_data_exporter/prom"
 )
 
 /*
@@ -47,10 +52,8 @@ func Test_getKeys(t *testing.T) {
 
 func Test_getSensorData(t *testing.T) {
 	//given
-	var inputData = map[string]interface{}{
-		"SI7021": map[interface{}]interface{}{
-			"Temperature": 123.23,
-		},
+	var inputData = map[string]json.RawMessage{
+		"SI7021": json.RawMessage(`{"Temperature":123.23}`),
 	}
 
 	//when
@@ -76,10 +79,8 @@ func Test_getSensorData(t *testing.T) {
 
 func Benchmark_getSensorData(b *testing.B) {
 	//given
-	var inputData = map[string]interface{}{
-		"SI7021": map[interface{}]interface{}{
-			"Temperature": 123.23,
-		},
+	var inputData = map[string]json.RawMessage{
+		"SI7021": json.RawMessage(`{"Temperature":123.23}`),
 	}
 
 	//when
@@ -92,11 +93,8 @@ func Benchmark_getSensorData(b *testing.B) {
 
 func Test_getSensorData_withTwoSensors(t *testing.T) {
 	//given
-	var inputData = map[string]interface{}{
-		"BMP280": map[interface{}]interface{}{
-			"Temperature": 124.23,
-			"Pressure":    1024,
-		},
+	var inputData = map[string]json.RawMessage{
+		"BMP280": json.RawMessage(`{"Temperature":124.23,"Pressure":1024}`),
 	}
 
 	//when
@@ -124,3 +122,167 @@ func Test_getSensorData_withTwoSensors(t *testing.T) {
 		t.Errorf("Value => Expected: %d, got: %+v", 1024, result[1].Value)
 	}
 }
+
+func Test_getIndexedBlockData_shutter(t *testing.T) {
+	//given
+	var inputData = map[string]json.RawMessage{
+		"Shutter1": json.RawMessage(`{"Position":50,"Direction":-1,"Target":0}`),
+	}
+	expected := []sensorData{
+		{Type: shutterPosition, SensorName: "Shutter1", Value: 50, Block: "Shutter", Index: "1"},
+		{Type: shutterDirection, SensorName: "Shutter1", Value: -1, Block: "Shutter", Index: "1"},
+		{Type: shutterTarget, SensorName: "Shutter1", Value: 0, Block: "Shutter", Index: "1"},
+	}
+
+	//when
+	result := getIndexedBlockData(inputData)
+
+	//then
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Shutter => Expected: %+v, got: %+v", expected, result)
+	}
+}
+
+func Test_getIndexedBlockData_thermostat(t *testing.T) {
+	//given
+	var inputData = map[string]json.RawMessage{
+		"Thermostat0": json.RawMessage(`{"ThermostatModeSet":1,"ControllerMethodSet":0,"TempTargetSet":21.5,"CtrDutyCycleRead":40}`),
+	}
+	expected := []sensorData{
+		{Type: thermostatSetpoint, SensorName: "Thermostat0", Value: 21.5, Block: "Thermostat", Index: "0"},
+		{Type: thermostatControlMethod, SensorName: "Thermostat0", Value: 0, Block: "Thermostat", Index: "0"},
+		{Type: thermostatOutput, SensorName: "Thermostat0", Value: 40, Block: "Thermostat", Index: "0"},
+		{Type: thermostatMode, SensorName: "Thermostat0", Value: 1, Block: "Thermostat", Index: "0"},
+	}
+
+	//when
+	result := getIndexedBlockData(inputData)
+
+	//then
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Thermostat => Expected: %+v, got: %+v", expected, result)
+	}
+}
+
+func Test_unmarshal_sensorWithShutters(t *testing.T) {
+	//given
+	input := []byte("{\"Time\":\"2020-03-01T10:00:00\",\"Shutter1\":{\"Position\":100,\"Direction\":0,\"Target\":100},\"Shutter2\":{\"Position\":0,\"Direction\":1,\"Target\":75}}")
+	result := sensor{}
+
+	//when
+	err := json.Unmarshal(input, &result)
+
+	//then
+	if err != nil || len(result.Sensors) != 6 {
+		t.Errorf("Size => Expected: %d, got: %d (error: %v)", 6, len(result.Sensors), err)
+		return
+	}
+	if result.Sensors[3].SensorName != "Shutter2" || result.Sensors[3].Index != "2" || result.Sensors[3].Value != 0 {
+		t.Errorf("Shutter2 => Expected position 0 of shutter 2, got: %+v", result.Sensors[3])
+	}
+}
+
+func Test_isSensorOrResultMessage(t *testing.T) {
+	//given
+	input := []string{"tele/device/SENSOR", "stat/device/RESULT", "tele/device/STATE"}
+	expected := []bool{true, true, false}
+
+	//when
+	for i := range input {
+		result := isSensorOrResultMessage(input[i])
+		if result != expected[i] {
+			t.Errorf("isSensorOrResultMessage => For: %q expected: %t, but got %t", input[i], expected[i], result)
+		}
+	}
+}
+
+var fullSensor = []byte("{\"Time\":\"2019-06-25T21:29:37\",\"Switch1\":\"OFF\",\"ANALOG\":{\"A0\":3},\"BME280\":{\"Temperature\":30.3,\"Humidity\":45.1,\"Pressure\":1010.7},\"BH1750\":{\"Illuminance\":120},\"SDS0X1\":{\"PM2.5\":7.3,\"PM10\":12.1},\"PressureUnit\":\"hPa\",\"TempUnit\":\"C\"}")
+
+func Test_unmarshal_fullSensor(t *testing.T) {
+	//given
+	expected := map[sensorType]float64{temperature: 30.3, humidity: 45.1, pressure: 1010.7, illuminance: 120, pm2: 7.3, pm10: 12.1}
+	result := sensor{}
+
+	//when
+	err := json.Unmarshal(fullSensor, &result)
+
+	//then
+	if err != nil || len(result.Sensors) != len(expected) {
+		t.Errorf("Size => Expected: %d, got: %d (error: %v)", len(expected), len(result.Sensors), err)
+	}
+	for _, data := range result.Sensors {
+		if data.Value != expected[data.Type] {
+			t.Errorf("%s => Expected: %f, got: %f", data.Type, expected[data.Type], data.Value)
+		}
+	}
+	if expectedUnits := map[sensorType]string{temperature: "celsius", pressure: "hectopascals"}; !reflect.DeepEqual(result.Units, expectedUnits) {
+		t.Errorf("Units => Expected: %v, got: %v", expectedUnits, result.Units)
+	}
+}
+
+func Test_unmarshal_sensorLargeInteger(t *testing.T) {
+	//given
+	input := []byte("{\"ENERGY\":{\"Total\":12345678901234}}")
+	result := sensor{}
+
+	//when
+	err := json.Unmarshal(input, &result)
+
+	//then
+	if err != nil || len(result.Sensors) != 1 || result.Sensors[0].Value != 12345678901234 {
+		t.Errorf("Total => Expected: %d, got: %+v (error: %v)", 12345678901234, result.Sensors, err)
+	}
+}
+
+func Benchmark_unmarshalFullSensor(b *testing.B) {
+	// Benchmark_unmarshalFullSensor (yaml.v3)    	   12238	    128813 ns/op	   92724 B/op	     372 allocs/op
+	// Benchmark_unmarshalFullSensor (json)       	   39151	     30156 ns/op	    5480 B/op	     154 allocs/op
+	logger.SetLogLevel(logger.OFF)
+	defer logger.SetLogLevel(logger.INFO)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		result := sensor{}
+		_ = json.Unmarshal(fullSensor, &result)
+	}
+}
+
+func Test_newSensorCollector_units(t *testing.T) {
+	//given
+	units := map[string]string{"Temperature": "celsius", "PM10": "micrograms_per_cubic_meter", "Unknown": "percent"}
+
+	//when
+	collector := newSensorCollector(prom.NewMetrics("", nil, 0, prom.Options{}), units, 0)
+
+	//then
+	if expected := map[sensorType]string{temperature: "celsius"}; !reflect.DeepEqual(collector.units, expected) {
+		t.Errorf("units => Expected: %v, got: %v", expected, collector.units)
+	}
+}
+
+func Test_checkUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		units    map[sensorType]string
+		expected map[string]bool
+	}{
+		{"configured unit", map[sensorType]string{temperature: "celsius"}, map[string]bool{}},
+		{"other unit", map[sensorType]string{temperature: "fahrenheit"}, map[string]bool{"plug/Temperature": true}},
+		{"unit not configured", map[sensorType]string{pressure: "hectopascals"}, map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//given
+			collector := newSensorCollector(prom.NewMetrics("", nil, 0, prom.Options{}), map[string]string{"Temperature": "celsius"}, 0)
+			reading := sensor{DeviceName: "plug", Units: tt.units}
+
+			//when
+			collector.checkUnits(reading)
+			collector.checkUnits(reading)
+
+			//then
+			if !reflect.DeepEqual(collector.mismatchedUnits, tt.expected) {
+				t.Errorf("mismatchedUnits => Expected: %v, got: %v", tt.expected, collector.mismatchedUnits)
+			}
+		})
+	}
+}
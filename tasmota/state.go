@@ -1,44 +1,65 @@
 package tasmota
 
 import (
+	"encoding/json"
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/klaper_/mqtt_data_exporter/backend"
 	"github.com/klaper_/mqtt_data_exporter/logger"
-	"github.com/klaper_/mqtt_data_exporter/prom"
-
-	"gopkg.in/yaml.v3"
 )
 
 const stateClientId = "tasmota_state"
 
-var durationRegex = regexp.MustCompile(`(?P<days>\d+)?T?(?P<hours>\d+)?:(?P<minutes>\d+)?:(?P<seconds>\d+)?`)
+// durationRegex matches "DDTHH:MM:SS" as well as bare "HH:MM:SS" sent by older firmware
+var durationRegex = regexp.MustCompile(`^(?:(?P<days>\d+)[T ])?(?P<hours>\d+):(?P<minutes>\d{1,2}):(?P<seconds>\d{1,2})$`)
+
+// hoursRegex matches the plain number of hours reported by very old firmware
+var hoursRegex = regexp.MustCompile(`^\d+$`)
+
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05"}
 
 type Wifi struct {
-	Ap      int    `yaml:"AP"`
-	Ssid    string `yaml:"SSId"`
-	Bssid   string `yaml:"BSSId"`
-	Channel int    `yaml:"Channel"`
-	Rssi    int    `yaml:"RSSI"`
+	Ap      int    `json:"AP"`
+	Ssid    string `json:"SSId"`
+	Bssid   string `json:"BSSId"`
+	Channel int    `json:"Channel"`
+	Rssi    int    `json:"RSSI"`
 }
 
 type state struct {
-	Uptime  time.Duration
-	Vcc     float64
-	Loadavg int
-	Power   float64
-	Wifi    Wifi
+	Uptime      time.Duration
+	UptimeKnown bool
+	Time        time.Time
+	Vcc         float64
+	Loadavg     int
+	Power       float64
+	Wifi        Wifi
 }
 
 type stateCollector struct {
-	metricsStore *prom.Metrics
-	channel      chan interface{}
+	metricsStore   backend.Store
+	channel        chan interface{}
+	retainedMaxAge time.Duration
 }
 
-func parseDuration(str string) time.Duration {
+func parseDuration(str string) (time.Duration, error) {
+	str = strings.TrimSpace(str)
+	if hoursRegex.MatchString(str) {
+		hours, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(hours) * time.Hour, nil
+	}
+
 	matches := durationRegex.FindStringSubmatch(str)
+	if matches == nil {
+		return 0, fmt.Errorf("unsupported uptime format: %q", str)
+	}
 
 	days, _ := strconv.Atoi(matches[1])
 	hours, _ := strconv.Atoi(matches[2])
@@ -48,7 +69,30 @@ func parseDuration(str string) time.Duration {
 	hour := int64(time.Hour)
 	minute := int64(time.Minute)
 	second := int64(time.Second)
-	return time.Duration(int64(days)*24*hour + int64(hours)*hour + int64(minutes)*minute + int64(seconds)*second)
+	return time.Duration(int64(days)*24*hour + int64(hours)*hour + int64(minutes)*minute + int64(seconds)*second), nil
+}
+
+func parseUptime(uptimeSec *int64, uptime string) (time.Duration, error) {
+	if uptimeSec != nil {
+		if *uptimeSec < 0 {
+			return 0, fmt.Errorf("negative UptimeSec: %d", *uptimeSec)
+		}
+		return time.Duration(*uptimeSec) * time.Second, nil
+	}
+	return parseDuration(uptime)
+}
+
+func parseTime(str string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if result, err := time.ParseInLocation(layout, str, time.Local); err == nil {
+			return result, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unsupported time format: %q", str)
+}
+
+func (state *state) BootTime() time.Time {
+	return state.Time.Add(-state.Uptime)
 }
 
 func parsePower(str string) float64 {
@@ -58,21 +102,31 @@ func parsePower(str string) float64 {
 	return 0
 }
 
-func (state *state) UnmarshalYAML(unmarshal func(interface{}) error) error {
+func (state *state) UnmarshalJSON(data []byte) error {
 	type alias struct {
-		Uptime  string  `yaml:"Uptime"`
-		Loadavg int     `yaml:"LoadAvg"`
-		Vcc     float64 `yaml:"Vcc"`
-		Power   string  `yaml:"POWER"`
-		Wifi    Wifi    `yaml:"Wifi"`
+		Time      string     `json:"Time"`
+		Uptime    jsonString `json:"Uptime"`
+		UptimeSec *int64     `json:"UptimeSec"`
+		Loadavg   int        `json:"LoadAvg"`
+		Vcc       float64    `json:"Vcc"`
+		Power     string     `json:"POWER"`
+		Wifi      Wifi       `json:"Wifi"`
 	}
 	var tmp alias
-	err := unmarshal(&tmp)
+	err := json.Unmarshal(data, &tmp)
 	if err != nil {
 		return err
 	}
 	logger.Debug(stateClientId, "Got %+v as state input", tmp)
-	state.Uptime = parseDuration(tmp.Uptime)
+	if uptime, err := parseUptime(tmp.UptimeSec, string(tmp.Uptime)); err != nil {
+		logger.Warn(stateClientId, "Could not parse uptime: %v", err)
+	} else {
+		state.Uptime = uptime
+		state.UptimeKnown = true
+	}
+	if deviceTime, err := parseTime(tmp.Time); err == nil {
+		state.Time = deviceTime
+	}
 	state.Loadavg = tmp.Loadavg
 	state.Wifi = tmp.Wifi
 	state.Vcc = tmp.Vcc
@@ -82,13 +136,19 @@ func (state *state) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
-func newStateCollector(metricsStore *prom.Metrics) (collector *stateCollector) {
+func newStateCollector(metricsStore backend.Store, retainedMaxAge time.Duration) (collector *stateCollector) {
 	metricsStore.RegisterGauge(
 		"upTimeGauge",
 		"tasmota_state_uptime",
 		"Uptime of tasmota entity",
 		[]string{},
 	)
+	metricsStore.RegisterGauge(
+		"bootTimeGauge",
+		"tasmota_state_boot_time",
+		"Boot time of tasmota entity as unix timestamp",
+		[]string{},
+	)
 	metricsStore.RegisterGauge(
 		"rssiGauge",
 		"tasmota_state_rssi",
@@ -102,8 +162,9 @@ func newStateCollector(metricsStore *prom.Metrics) (collector *stateCollector) {
 		[]string{},
 	)
 	return &stateCollector{
-		metricsStore: metricsStore,
-		channel:      make(chan interface{}),
+		metricsStore:   metricsStore,
+		channel:        make(chan interface{}),
+		retainedMaxAge: retainedMaxAge,
 	}
 }
 
@@ -114,21 +175,26 @@ func isStateMessage(topic string) bool {
 
 func (collector *stateCollector) collector() {
 	for tmp := range collector.channel {
-		message, err := receiveMessage(tmp, stateClientId, isStateMessage)
+		message, err := receiveMessage(tmp, stateClientId, isStateMessage, collector.retainedMaxAge)
 		if err != nil {
 			continue
 		}
 
 		state := state{}
-		err = yaml.Unmarshal((message).Payload(), &state)
+		err = json.Unmarshal((message).Payload(), &state)
 		if err != nil {
 			logger.Fatal(stateClientId, "error while unmarshaling", err)
 			continue
 		}
-		collector.metricsStore.GaugeSet("upTimeGauge", message.GetDeviceName(), map[string]string{}, state.Uptime.Seconds())
-		collector.metricsStore.GaugeSet("powerGauge", message.GetDeviceName(), map[string]string{}, state.Power)
+		if state.UptimeKnown {
+			collector.metricsStore.GaugeSetWithTimestamp("upTimeGauge", message.GetDeviceName(), map[string]string{}, state.Uptime.Seconds(), state.Time)
+			if !state.Time.IsZero() {
+				collector.metricsStore.GaugeSet("bootTimeGauge", message.GetDeviceName(), map[string]string{}, float64(state.BootTime().Unix()))
+			}
+		}
+		collector.metricsStore.GaugeSetWithTimestamp("powerGauge", message.GetDeviceName(), map[string]string{}, state.Power, state.Time)
 
-		collector.metricsStore.GaugeSet(
+		collector.metricsStore.GaugeSetWithTimestamp(
 			"rssiGauge",
 			message.GetDeviceName(),
 			map[string]string{
@@ -138,6 +204,7 @@ func (collector *stateCollector) collector() {
 				"ap_index": strconv.Itoa(state.Wifi.Ap),
 			},
 			float64(state.Wifi.Rssi),
+			state.Time,
 		)
 	}
 }
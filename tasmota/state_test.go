@@ -1,37 +1,73 @@
 package tasmota
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
-	"gopkg.in/yaml.v3"
+	"github.com/klaper_/mqtt_data_exporter/logger"
 )
 
 var durationData = map[string]float64{
-	"0T00:00:00": 0,
-	"0T00:00:01": 1,
-	"0T00:00:10": 10,
-	"0T00:01:00": 60,
-	"0T00:10:00": 600,
-	"0T01:00:00": 3600,
-	"0T10:00:00": 36000,
+	"0T00:00:00":  0,
+	"0T00:00:01":  1,
+	"0T00:00:10":  10,
+	"0T00:01:00":  60,
+	"0T00:10:00":  600,
+	"0T01:00:00":  3600,
+	"0T10:00:00":  36000,
+	"1T00:00:00":  86400,
+	"41T12:28:52": 3587332,
+	"12:28:52":    44932,
+	"00:00:05":    5,
+	"1 01:00:00":  90000,
+	"17":          61200,
 }
 
 func Test_parseDuration(t *testing.T) {
 	for input := range durationData {
 		//when
-		result := parseDuration(input)
+		result, err := parseDuration(input)
 
 		//then
+		if err != nil {
+			t.Errorf("\"%s\" returned error: %v", input, err)
+		}
 		if result.Seconds() != durationData[input] {
 			t.Errorf("\"%s\" != \"%f\" but %f", input, durationData[input], result.Seconds())
 		}
 	}
 }
 
+func Test_parseDuration_invalid(t *testing.T) {
+	for _, input := range []string{"", "T", "abc", "1T", "12:34", "1T12:34:56:78"} {
+		//when
+		_, err := parseDuration(input)
+
+		//then
+		if err == nil {
+			t.Errorf("\"%s\" expected error", input)
+		}
+	}
+}
+
+func Test_parseUptime_prefersUptimeSec(t *testing.T) {
+	//given
+	uptimeSec := int64(3586133)
+
+	//when
+	result, err := parseUptime(&uptimeSec, "0T00:00:01")
+
+	//then
+	if err != nil || result.Seconds() != 3586133 {
+		t.Errorf("expected: %d, got: %f (error: %v)", uptimeSec, result.Seconds(), err)
+	}
+}
+
 func Benchmark_parseDuration(b *testing.B) {
 	// Benchmark_parseDuration-8   	 2000000	       954 ns/op
 	for i := 0; i < b.N; i++ {
-		parseDuration("4T12:34:56")
+		_, _ = parseDuration("4T12:34:56")
 	}
 }
 
@@ -56,13 +92,69 @@ func Test_parsePower(t *testing.T) {
 var fullState = []byte("{\"Time\":\"2019-06-25T11:04:34\",\"Uptime\":\"41T12:28:52\",\"Vcc\":3.480,\"SleepMode\":\"Dynamic\",\"Sleep\":250,\"LoadAvg\":3,\"POWER\":\"ON\",\"Wifi\":{\"AP\":1,\"SSId\":\"example_ssid\",\"BSSId\":\"01:02:03:04:05:06\",\"Channel\":6,\"RSSI\":80}}")
 var wifiState = []byte("{\"AP\":2,\"SSId\":\"example_ssid2\",\"BSSId\":\"06:05:04:03:02:01\",\"Channel\":2,\"RSSI\":52}")
 
+func Test_unmarshal_uptimeSec(t *testing.T) {
+	//given
+	input := []byte("{\"Time\":\"2019-06-25T11:04:34\",\"Uptime\":\"41T12:28:52\",\"UptimeSec\":3586133}")
+	result := state{}
+
+	//when
+	err := json.Unmarshal(input, &result)
+
+	//then
+	if err != nil || !result.UptimeKnown || result.Uptime.Seconds() != 3586133 {
+		t.Errorf("expected: %d, got: %f (known: %t, error: %v)", 3586133, result.Uptime.Seconds(), result.UptimeKnown, err)
+	}
+}
+
+func Test_unmarshal_hoursUptime(t *testing.T) {
+	//given
+	input := []byte("{\"Uptime\":17}")
+	result := state{}
+
+	//when
+	err := json.Unmarshal(input, &result)
+
+	//then
+	if err != nil || !result.UptimeKnown || result.Uptime.Hours() != 17 {
+		t.Errorf("expected: %d hours, got: %f (known: %t, error: %v)", 17, result.Uptime.Hours(), result.UptimeKnown, err)
+	}
+}
+
+func Test_unmarshal_invalidUptime(t *testing.T) {
+	//given
+	input := []byte("{\"Uptime\":\"yesterday\",\"POWER\":\"ON\"}")
+	result := state{}
+
+	//when
+	err := json.Unmarshal(input, &result)
+
+	//then
+	if err != nil || result.UptimeKnown || result.Power != 1 {
+		t.Errorf("expected unknown uptime with parsed power, got: %+v (error: %v)", result, err)
+	}
+}
+
+func Test_unmarshal_bootTime(t *testing.T) {
+	//given
+	expected := time.Date(2019, 5, 14, 22, 35, 42, 0, time.Local)
+	result := state{}
+
+	//when
+	json.Unmarshal(fullState, &result)
+
+	//then
+	if !result.BootTime().Equal(expected) {
+		t.Errorf("expected: %s, got: %s", expected, result.BootTime())
+	}
+}
+
 func Test_unmarshal_loadavg(t *testing.T) {
 	//given
 	expected := 3
 	result := state{}
 
 	//when
-	yaml.Unmarshal(fullState, &result)
+	json.Unmarshal(fullState, &result)
 
 	//then
 	if result.Loadavg != expected {
@@ -76,7 +168,7 @@ func Test_unmarshal_power(t *testing.T) {
 	result := state{}
 
 	//when
-	yaml.Unmarshal(fullState, &result)
+	json.Unmarshal(fullState, &result)
 
 	//then
 	if result.Power != expected {
@@ -90,7 +182,7 @@ func Test_unmarshal_vcc(t *testing.T) {
 	result := state{}
 
 	//when
-	yaml.Unmarshal(fullState, &result)
+	json.Unmarshal(fullState, &result)
 
 	//then
 	if result.Vcc != expected {
@@ -100,11 +192,11 @@ func Test_unmarshal_vcc(t *testing.T) {
 
 func Test_unmarshal_wifi(t *testing.T) {
 	//given
-	expected := Wifi{Ap: 1, Ssid: "example_ssid", Bssid: "01:02:03:04:05:06",Channel: 6, Rssi: 80}
+	expected := Wifi{Ap: 1, Ssid: "example_ssid", Bssid: "01:02:03:04:05:06", Channel: 6, Rssi: 80}
 	result := state{}
 
 	//when
-	yaml.Unmarshal(fullState, &result)
+	json.Unmarshal(fullState, &result)
 
 	//then
 	if result.Wifi != expected {
@@ -118,7 +210,7 @@ func Test_unmarshal_wifi_ap(t *testing.T) {
 	result := Wifi{}
 
 	//when
-	yaml.Unmarshal(wifiState, &result)
+	json.Unmarshal(wifiState, &result)
 
 	//then
 	if result.Ap != expected {
@@ -132,7 +224,7 @@ func Test_unmarshal_wifi_ssid(t *testing.T) {
 	result := Wifi{}
 
 	//when
-	yaml.Unmarshal(wifiState, &result)
+	json.Unmarshal(wifiState, &result)
 
 	//then
 	if result.Ssid != expected {
@@ -146,7 +238,7 @@ func Test_unmarshal_wifi_channel(t *testing.T) {
 	result := Wifi{}
 
 	//when
-	yaml.Unmarshal(wifiState, &result)
+	json.Unmarshal(wifiState, &result)
 
 	//then
 	if result.Channel != expected {
@@ -160,7 +252,7 @@ func Test_unmarshal_wifi_rssi(t *testing.T) {
 	result := Wifi{}
 
 	//when
-	yaml.Unmarshal(wifiState, &result)
+	json.Unmarshal(wifiState, &result)
 
 	//then
 	if result.Rssi != expected {
@@ -180,3 +272,15 @@ func Test_isTasmotaStateMessage(t *testing.T) {
 		}
 	}
 }
+
+func Benchmark_unmarshalFullState(b *testing.B) {
+	// Benchmark_unmarshalFullState (yaml.v3)    	   20307	     64195 ns/op	   64502 B/op	     160 allocs/op
+	// Benchmark_unmarshalFullState (json)       	  112086	      9393 ns/op	     792 B/op	       9 allocs/op
+	logger.SetLogLevel(logger.OFF)
+	defer logger.SetLogLevel(logger.INFO)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		result := state{}
+		_ = json.Unmarshal(fullState, &result)
+	}
+}
@@ -1,25 +1,43 @@
 package tasmota
 
 import (
+	"time"
+
 	"github.com/dustin/go-broadcast"
-	"github.com/klaper_/mqtt_data_exporter/prom"
+	"github.com/klaper_/mqtt_data_exporter/backend"
+	"github.com/klaper_/mqtt_data_exporter/devices"
 )
 
 type Collector struct {
 	state  *stateCollector
 	sensor *sensorCollector
+	result *resultCollector
+	info   *infoCollector
 }
 
-func NewTasmotaCollector(metricsStore *prom.Metrics) *Collector {
-	return &Collector{
-		state:  newStateCollector(metricsStore),
-		sensor: newSensorCollector(metricsStore),
+// NewTasmotaCollector creates collectors of tasmota messages; sensorUnits are units of sensor readouts
+// (e.g. Temperature=celsius), names reported by devices are learned into autoNaming unless it is nil
+func NewTasmotaCollector(metricsStore backend.Store, resultAllowedCodes []string, sensorUnits map[string]string, retainedMaxAge time.Duration, autoNaming *devices.AutoProperties) *Collector {
+	collector := &Collector{
+		state:  newStateCollector(metricsStore, retainedMaxAge),
+		sensor: newSensorCollector(metricsStore, sensorUnits, retainedMaxAge),
+		result: newResultCollector(metricsStore, resultAllowedCodes, retainedMaxAge),
+	}
+	if autoNaming != nil {
+		collector.info = newInfoCollector(metricsStore, autoNaming, retainedMaxAge)
 	}
+	return collector
 }
 
 func (collector *Collector) InitializeMessageReceiver(broadcaster broadcast.Broadcaster) {
 	broadcaster.Register(collector.state.channel)
 	broadcaster.Register(collector.sensor.channel)
+	broadcaster.Register(collector.result.channel)
 	go collector.state.collector()
 	go collector.sensor.collector()
+	go collector.result.collector()
+	if collector.info != nil {
+		broadcaster.Register(collector.info.channel)
+		go collector.info.collector()
+	}
 }